@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// memoryEventNames are the memory.events counters that can trigger a dump.
+var memoryEventNames = []string{"low", "high", "max", "oom", "oom_kill"}
+
+// containerCgroupDir returns the cgroup v2 directory of a container under the
+// host cgroup root, for both the systemd and the cgroupfs cgroup drivers.
+func containerCgroupDir(root, containerID string) (string, error) {
+	candidates := []string{
+		filepath.Join(root, "system.slice", "docker-"+containerID+".scope"),
+		filepath.Join(root, "docker", containerID),
+	}
+	for _, dir := range candidates {
+		if _, err := os.Stat(filepath.Join(dir, "memory.pressure")); err == nil {
+			return dir, nil
+		}
+	}
+	// Nested setups (e.g. Docker in a systemd slice of its own)
+	matches, _ := filepath.Glob(filepath.Join(root, "*", "*"+containerID+"*", "memory.pressure"))
+	if len(matches) > 0 {
+		return filepath.Dir(matches[0]), nil
+	}
+	return "", fmt.Errorf("no cgroup v2 directory found for container %s under %s", shortID(containerID), root)
+}
+
+// readMemoryPressure returns the avg10 values of the "some" and "full" lines
+// of memory.pressure, e.g. "some avg10=1.50 avg60=0.80 avg300=0.20 total=12345".
+func readMemoryPressure(dir string) (float64, float64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "memory.pressure"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read memory.pressure: %v", err)
+	}
+	var some, full float64
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || !strings.HasPrefix(fields[1], "avg10=") {
+			continue
+		}
+		value, err := strconv.ParseFloat(strings.TrimPrefix(fields[1], "avg10="), 64)
+		if err != nil {
+			return 0, 0, fmt.Errorf("failed to parse memory.pressure: %v", err)
+		}
+		switch fields[0] {
+		case "some":
+			some = value
+		case "full":
+			full = value
+		}
+	}
+	return some, full, nil
+}
+
+// readMemoryEvents returns the counters of memory.events, e.g. "oom_kill 1".
+func readMemoryEvents(dir string) (map[string]uint64, error) {
+	data, err := os.ReadFile(filepath.Join(dir, "memory.events"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory.events: %v", err)
+	}
+	events := map[string]uint64{}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse memory.events: %v", err)
+		}
+		events[fields[0]] = value
+	}
+	return events, nil
+}
+
+// cgroupTrigger reads the memory pressure stall information and the memory
+// events of the container cgroup. It fires when the "some" or "full" avg10
+// pressure reaches its limit, or when one of the watched memory.events
+// counters increases.
+type cgroupTrigger struct {
+	root    string
+	psiSome float64
+	psiFull float64
+	events  []string
+
+	dir        string
+	lastEvents map[string]uint64
+}
+
+func (c *cgroupTrigger) window() time.Duration {
+	return 0
+}
+
+func (c *cgroupTrigger) check(m *containerMonitor, _ memorySample) string {
+	if c.dir == "" {
+		inspect, err := helpers.InspectContainer(m.settings.client, m.target.Container, m.settings.baseDockerURL)
+		if err != nil {
+			m.logf("Error resolving the container cgroup: %v", err)
+			return ""
+		}
+		c.dir, err = containerCgroupDir(c.root, inspect.ID)
+		if err != nil {
+			m.logf("Error resolving the container cgroup: %v", err)
+			return ""
+		}
+	}
+
+	if c.psiSome > 0 || c.psiFull > 0 {
+		some, full, err := readMemoryPressure(c.dir)
+		if err != nil {
+			m.logf("Error reading memory pressure: %v", err)
+			c.dir = ""
+			return ""
+		}
+		m.logf("Memory pressure (avg10): some %.2f%%, full %.2f%%", some, full)
+		if c.psiSome > 0 && some >= c.psiSome {
+			return fmt.Sprintf("memory pressure some avg10 %.2f%% reached the limit of %.2f%%", some, c.psiSome)
+		}
+		if c.psiFull > 0 && full >= c.psiFull {
+			return fmt.Sprintf("memory pressure full avg10 %.2f%% reached the limit of %.2f%%", full, c.psiFull)
+		}
+	}
+
+	if len(c.events) > 0 {
+		events, err := readMemoryEvents(c.dir)
+		if err != nil {
+			m.logf("Error reading memory events: %v", err)
+			c.dir = ""
+			return ""
+		}
+		previous := c.lastEvents
+		c.lastEvents = events
+		// The first reading is the baseline, only new events count
+		if previous == nil {
+			return ""
+		}
+		for _, name := range c.events {
+			if events[name] > previous[name] {
+				return fmt.Sprintf("memory.events %s increased from %d to %d", name, previous[name], events[name])
+			}
+		}
+	}
+	return ""
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeCgroupFiles(t *testing.T, dir, pressure, events string) {
+	t.Helper()
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "memory.pressure"), []byte(pressure), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "memory.events"), []byte(events), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestContainerCgroupDir(t *testing.T) {
+	root := t.TempDir()
+	systemd := filepath.Join(root, "system.slice", "docker-abc123.scope")
+	cgroupfs := filepath.Join(root, "docker", "def456")
+	writeCgroupFiles(t, systemd, "", "")
+	writeCgroupFiles(t, cgroupfs, "", "")
+
+	if dir, err := containerCgroupDir(root, "abc123"); err != nil || dir != systemd {
+		t.Errorf("Expected %s, got %s (%v)", systemd, dir, err)
+	}
+	if dir, err := containerCgroupDir(root, "def456"); err != nil || dir != cgroupfs {
+		t.Errorf("Expected %s, got %s (%v)", cgroupfs, dir, err)
+	}
+	if _, err := containerCgroupDir(root, "missing"); err == nil {
+		t.Error("Expected an error for an unknown container")
+	}
+}
+
+func TestReadMemoryPressure(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFiles(t, dir,
+		"some avg10=12.50 avg60=3.10 avg300=0.80 total=123456\nfull avg10=4.25 avg60=1.00 avg300=0.20 total=45678\n", "")
+
+	some, full, err := readMemoryPressure(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if some != 12.5 || full != 4.25 {
+		t.Errorf("Expected some 12.5 and full 4.25, got %f and %f", some, full)
+	}
+}
+
+func TestReadMemoryEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFiles(t, dir, "", "low 0\nhigh 17\nmax 3\noom 1\noom_kill 1\n")
+
+	events, err := readMemoryEvents(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if events["high"] != 17 || events["max"] != 3 || events["oom_kill"] != 1 {
+		t.Errorf("Unexpected memory events: %v", events)
+	}
+}
+
+func TestCgroupTrigger(t *testing.T) {
+	dir := t.TempDir()
+	m := &containerMonitor{target: targetConfig{Container: "test-container"}}
+
+	// The cgroup directory is already resolved, so no Docker call is made
+	psi := &cgroupTrigger{psiSome: 10, dir: dir}
+	writeCgroupFiles(t, dir, "some avg10=5.00 avg60=0 avg300=0 total=1\nfull avg10=0.00 avg60=0 avg300=0 total=0\n", "")
+	if reason := psi.check(m, memorySample{}); reason != "" {
+		t.Errorf("Expected no trigger, got %q", reason)
+	}
+	writeCgroupFiles(t, dir, "some avg10=15.00 avg60=0 avg300=0 total=1\nfull avg10=0.00 avg60=0 avg300=0 total=0\n", "")
+	if reason := psi.check(m, memorySample{}); reason == "" {
+		t.Error("Expected the memory pressure trigger to fire")
+	}
+
+	events := &cgroupTrigger{events: []string{"max"}, dir: dir}
+	writeCgroupFiles(t, dir, "", "high 5\nmax 2\n")
+	if reason := events.check(m, memorySample{}); reason != "" {
+		t.Errorf("Expected the first reading to be the baseline, got %q", reason)
+	}
+	writeCgroupFiles(t, dir, "", "high 9\nmax 2\n")
+	if reason := events.check(m, memorySample{}); reason != "" {
+		t.Errorf("Expected no trigger on an unwatched counter, got %q", reason)
+	}
+	writeCgroupFiles(t, dir, "", "high 9\nmax 3\n")
+	if reason := events.check(m, memorySample{}); reason == "" {
+		t.Error("Expected the memory events trigger to fire")
+	}
+}
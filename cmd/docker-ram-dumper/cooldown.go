@@ -0,0 +1,68 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// dumpGate keeps a single incident from producing a burst of near-identical
+// dumps: after a dump, no other dump is allowed until the cooldown has passed
+// and, when a re-arm watermark is set, until memory has dropped below it.
+type dumpGate struct {
+	cooldown time.Duration
+	// rearmPercent is the re-arm watermark, resolved against the memory limit
+	rearmPercent float64
+
+	lastDump time.Time
+	disarmed bool
+}
+
+// resolveRearm converts the target re-arm watermark into a percentage of the
+// memory limit, the same way the threshold is resolved.
+func (m *containerMonitor) resolveRearm() {
+	if m.target.Rearm == "" {
+		return
+	}
+	value, isPercentage, _ := parseThreshold(m.target.Rearm)
+	if !isPercentage {
+		value = value / float64(m.memoryLimitMB) * 100
+	}
+	m.gate.rearmPercent = value
+	m.logf("Re-arm watermark: %.0f%%", m.gate.rearmPercent)
+}
+
+// dumpAllowed reports whether the cooldown and re-arm rules allow a dump now.
+func (m *containerMonitor) dumpAllowed(now time.Time) bool {
+	if m.gate.disarmed {
+		if m.lastUsagePercent >= m.gate.rearmPercent {
+			m.logf("Dumps are disarmed until memory usage drops below %.2f%% (now %.2f%%)", m.gate.rearmPercent, m.lastUsagePercent)
+			return false
+		}
+		m.logf("Memory usage dropped below %.2f%%, dumps are re-armed", m.gate.rearmPercent)
+		m.gate.disarmed = false
+	}
+	if remaining := m.gate.cooldown - now.Sub(m.gate.lastDump); !m.gate.lastDump.IsZero() && remaining > 0 {
+		m.logf("Dump cooldown: %v remaining", remaining.Round(time.Second))
+		return false
+	}
+	return true
+}
+
+// recordDump starts the cooldown and disarms dumps after a successful dump.
+func (m *containerMonitor) recordDump(t time.Time) {
+	m.gate.lastDump = t
+	if m.target.Rearm != "" {
+		m.gate.disarmed = true
+	}
+}
+
+func parseCooldown(cooldown string) (time.Duration, error) {
+	if cooldown == "" {
+		return 0, nil
+	}
+	duration, err := time.ParseDuration(cooldown)
+	if err != nil {
+		return 0, fmt.Errorf("invalid cooldown %q: %v", cooldown, err)
+	}
+	return duration, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDumpGate(t *testing.T) {
+	m := &containerMonitor{target: targetConfig{Container: "test-container", Rearm: "2400MB"}, memoryLimitMB: 4000}
+	m.gate.cooldown = 10 * time.Minute
+	m.resolveRearm()
+	if m.gate.rearmPercent != 60 {
+		t.Fatalf("Expected a re-arm watermark of 60%%, got %.2f%%", m.gate.rearmPercent)
+	}
+
+	start := time.Unix(0, 0)
+	m.lastUsagePercent = 95
+	if !m.dumpAllowed(start) {
+		t.Fatal("Expected the first dump to be allowed")
+	}
+	m.recordDump(start)
+
+	// Still above the watermark
+	if m.dumpAllowed(start.Add(time.Hour)) {
+		t.Error("Expected dumps to be disarmed above the re-arm watermark")
+	}
+
+	// Below the watermark, but within the cooldown
+	m.lastUsagePercent = 50
+	m.gate.lastDump = start.Add(55 * time.Minute)
+	if m.dumpAllowed(start.Add(time.Hour)) {
+		t.Error("Expected no dump during the cooldown")
+	}
+
+	// Back above the threshold once the cooldown is over
+	m.lastUsagePercent = 95
+	if !m.dumpAllowed(start.Add(2 * time.Hour)) {
+		t.Error("Expected a dump once re-armed and the cooldown is over")
+	}
+}
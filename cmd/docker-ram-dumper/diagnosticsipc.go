@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf16"
+)
+
+// The .NET runtime listens for diagnostics commands on a Unix socket named
+// /tmp/dotnet-diagnostic-<pid>-<key>-socket. Every message starts with a
+// 20 byte header: the "DOTNET_IPC_V1\0" magic, the total message size, the
+// command set, the command ID and two reserved bytes.
+// See https://github.com/dotnet/diagnostics/blob/main/documentation/design-docs/ipc-protocol.md
+const (
+	ipcHeaderSize = 20
+
+	ipcCommandSetDump   = 0x01
+	ipcCommandSetServer = 0xFF
+
+	ipcDumpCreateRequest = 0x01
+
+	ipcServerOK    = 0x00
+	ipcServerError = 0xFF
+
+	// diagnosticsDumpTimeout bounds the whole dump request, writing a full
+	// dump of a large heap can take several minutes.
+	diagnosticsDumpTimeout = 30 * time.Minute
+)
+
+var ipcMagic = [14]byte{'D', 'O', 'T', 'N', 'E', 'T', '_', 'I', 'P', 'C', '_', 'V', '1', 0}
+
+// Dump types of the DumpCreateRequest command.
+const (
+	diagnosticsDumpMini   uint32 = 1
+	diagnosticsDumpHeap   uint32 = 2
+	diagnosticsDumpTriage uint32 = 3
+	diagnosticsDumpFull   uint32 = 4
+)
+
+type ipcHeader struct {
+	Magic      [14]byte
+	Size       uint16
+	CommandSet uint8
+	CommandID  uint8
+	Reserved   uint16
+}
+
+// diagnosticsSocket returns the diagnostics socket of the process pid of a
+// container, reached through the root filesystem of its host process
+// hostPID. When the runtime restarted, the most recent socket is returned.
+func diagnosticsSocket(procRoot string, hostPID, pid int) (string, error) {
+	pattern := filepath.Join(procRoot, strconv.Itoa(hostPID), "root", "tmp", fmt.Sprintf("dotnet-diagnostic-%d-*-socket", pid))
+	sockets, err := filepath.Glob(pattern)
+	if err != nil {
+		return "", err
+	}
+	if len(sockets) == 0 {
+		return "", fmt.Errorf("no diagnostics socket found for process %d, diagnostics may be disabled with DOTNET_EnableDiagnostics=0", pid)
+	}
+	sort.Strings(sockets)
+	return sockets[len(sockets)-1], nil
+}
+
+// encodeDumpCreateRequest encodes a DumpCreateRequest writing a dump of type
+// dumpType to dumpName, a path in the filesystem of the target process.
+func encodeDumpCreateRequest(dumpName string, dumpType uint32) ([]byte, error) {
+	var payload bytes.Buffer
+	// Strings are a length in UTF-16 code units, null terminator included,
+	// followed by the UTF-16LE code units.
+	name := append(utf16.Encode([]rune(dumpName)), 0)
+	binary.Write(&payload, binary.LittleEndian, uint32(len(name)))
+	binary.Write(&payload, binary.LittleEndian, name)
+	binary.Write(&payload, binary.LittleEndian, dumpType)
+	// Diagnostics flags, logging of the dump generation is not needed
+	binary.Write(&payload, binary.LittleEndian, uint32(0))
+
+	size := ipcHeaderSize + payload.Len()
+	if size > 0xFFFF {
+		return nil, fmt.Errorf("dump name is too long: %s", dumpName)
+	}
+	var message bytes.Buffer
+	binary.Write(&message, binary.LittleEndian, ipcHeader{
+		Magic:      ipcMagic,
+		Size:       uint16(size),
+		CommandSet: ipcCommandSetDump,
+		CommandID:  ipcDumpCreateRequest,
+	})
+	message.Write(payload.Bytes())
+	return message.Bytes(), nil
+}
+
+// createDiagnosticsDump asks the runtime listening on socketPath to write a
+// dump of itself to dumpName and waits for the dump to complete.
+func createDiagnosticsDump(socketPath, dumpName string, dumpType uint32) error {
+	request, err := encodeDumpCreateRequest(dumpName, dumpType)
+	if err != nil {
+		return err
+	}
+	conn, err := net.DialTimeout("unix", socketPath, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("failed to connect to diagnostics socket %s: %v", socketPath, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(diagnosticsDumpTimeout))
+
+	if _, err := conn.Write(request); err != nil {
+		return fmt.Errorf("failed to send dump request: %v", err)
+	}
+
+	var header ipcHeader
+	if err := binary.Read(conn, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("failed to read dump response: %v", err)
+	}
+	if header.Magic != ipcMagic || header.CommandSet != ipcCommandSetServer || header.Size < ipcHeaderSize {
+		return fmt.Errorf("unexpected dump response header: %+v", header)
+	}
+	payload := make([]byte, int(header.Size)-ipcHeaderSize)
+	if _, err := io.ReadFull(conn, payload); err != nil {
+		return fmt.Errorf("failed to read dump response: %v", err)
+	}
+	var hresult uint32
+	if len(payload) >= 4 {
+		hresult = binary.LittleEndian.Uint32(payload)
+	}
+
+	switch header.CommandID {
+	case ipcServerOK:
+		if hresult != 0 {
+			return fmt.Errorf("dump request failed with HRESULT 0x%08X", hresult)
+		}
+		return nil
+	case ipcServerError:
+		return fmt.Errorf("runtime rejected the dump request with HRESULT 0x%08X", hresult)
+	default:
+		return fmt.Errorf("unexpected dump response command 0x%02X", header.CommandID)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+// fakeDiagnosticsRuntime listens on socketPath like the .NET runtime and
+// answers a single DumpCreateRequest with command ID and HRESULT. The dump
+// name of the request is sent to names.
+func fakeDiagnosticsRuntime(t *testing.T, socketPath string, commandID uint8, hresult uint32, names chan<- string) {
+	t.Helper()
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("Failed to listen on %s: %v", socketPath, err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var header ipcHeader
+		if err := binary.Read(conn, binary.LittleEndian, &header); err != nil {
+			return
+		}
+		payload := make([]byte, int(header.Size)-ipcHeaderSize)
+		if _, err := io.ReadFull(conn, payload); err != nil {
+			return
+		}
+		length := binary.LittleEndian.Uint32(payload)
+		name := make([]uint16, length)
+		binary.Read(bytes.NewReader(payload[4:]), binary.LittleEndian, name)
+		names <- string(utf16.Decode(name[:length-1]))
+
+		binary.Write(conn, binary.LittleEndian, ipcHeader{Magic: ipcMagic, Size: ipcHeaderSize + 4, CommandSet: ipcCommandSetServer, CommandID: commandID})
+		binary.Write(conn, binary.LittleEndian, hresult)
+	}()
+}
+
+func TestEncodeDumpCreateRequest(t *testing.T) {
+	request, err := encodeDumpCreateRequest("/tmp/a.dmp", diagnosticsDumpFull)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// Header, name length, 11 UTF-16 code units, dump type and flags
+	expectedSize := ipcHeaderSize + 4 + 11*2 + 4 + 4
+	if len(request) != expectedSize {
+		t.Fatalf("Unexpected request size: got %d, want %d", len(request), expectedSize)
+	}
+	if !bytes.HasPrefix(request, []byte("DOTNET_IPC_V1\x00")) {
+		t.Errorf("Missing IPC magic: %q", request[:14])
+	}
+	if size := binary.LittleEndian.Uint16(request[14:]); int(size) != expectedSize {
+		t.Errorf("Unexpected header size: got %d, want %d", size, expectedSize)
+	}
+	if request[16] != ipcCommandSetDump || request[17] != ipcDumpCreateRequest {
+		t.Errorf("Unexpected command: %#x/%#x", request[16], request[17])
+	}
+	if length := binary.LittleEndian.Uint32(request[20:]); length != 11 {
+		t.Errorf("Unexpected name length: got %d, want 11", length)
+	}
+	if dumpType := binary.LittleEndian.Uint32(request[expectedSize-8:]); dumpType != diagnosticsDumpFull {
+		t.Errorf("Unexpected dump type: got %d, want %d", dumpType, diagnosticsDumpFull)
+	}
+}
+
+func TestDiagnosticsSocket(t *testing.T) {
+	procRoot := t.TempDir()
+	tmp := filepath.Join(procRoot, "4242", "root", "tmp")
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"dotnet-diagnostic-7-1000-socket", "dotnet-diagnostic-7-2000-socket", "dotnet-diagnostic-8-3000-socket"} {
+		if err := os.WriteFile(filepath.Join(tmp, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	socket, err := diagnosticsSocket(procRoot, 4242, 7)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if expected := filepath.Join(tmp, "dotnet-diagnostic-7-2000-socket"); socket != expected {
+		t.Errorf("Unexpected socket: got %s, want %s", socket, expected)
+	}
+	if _, err := diagnosticsSocket(procRoot, 4242, 9); err == nil {
+		t.Error("Expected an error for a process without a socket")
+	}
+}
+
+func TestCreateDiagnosticsDump(t *testing.T) {
+	dir, err := os.MkdirTemp("", "ipc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	names := make(chan string, 1)
+	socket := filepath.Join(dir, "ok.sock")
+	fakeDiagnosticsRuntime(t, socket, ipcServerOK, 0, names)
+	if err := createDiagnosticsDump(socket, "/tmp/core_7.dmp", diagnosticsDumpHeap); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if name := <-names; name != "/tmp/core_7.dmp" {
+		t.Errorf("Unexpected dump name: %s", name)
+	}
+
+	socket = filepath.Join(dir, "error.sock")
+	fakeDiagnosticsRuntime(t, socket, ipcServerError, 0x80004005, names)
+	err = createDiagnosticsDump(socket, "/tmp/core_7.dmp", diagnosticsDumpHeap)
+	if err == nil || !strings.Contains(err.Error(), "0x80004005") {
+		t.Errorf("Expected an error with the HRESULT, got %v", err)
+	}
+}
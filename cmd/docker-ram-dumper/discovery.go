@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// labelPrefix is the prefix of the container labels overriding target settings,
+// e.g. ram-dumper.threshold=85% or ram-dumper.process=nethermind.
+const labelPrefix = "ram-dumper."
+
+// discovery starts a monitor for every running container matching the label
+// selector, and keeps looking for new matching containers while monitoring.
+type discovery struct {
+	settings monitorSettings
+	selector []string
+	defaults targetConfig
+	group    *monitorGroup
+
+	// known holds the names of the containers that already have a monitor.
+	// Monitors follow containers by name, a container recreated under the
+	// same name is picked up by its existing monitor on its start event.
+	known map[string]bool
+}
+
+func newDiscovery(settings monitorSettings, selector string, defaults targetConfig, group *monitorGroup) *discovery {
+	return &discovery{
+		settings: settings,
+		selector: splitList(selector),
+		defaults: defaults,
+		group:    group,
+		known:    map[string]bool{},
+	}
+}
+
+func (d *discovery) run(ctx context.Context) {
+	for {
+		if err := d.discover(ctx); err != nil {
+			fmt.Println("Error discovering containers:", err)
+		}
+		if !d.settings.monitor {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.settings.checkInterval):
+		}
+	}
+}
+
+// discover lists the matching containers and starts monitoring the new ones.
+func (d *discovery) discover(ctx context.Context) error {
+	targets, err := d.newTargets()
+	if err != nil {
+		return err
+	}
+	for _, target := range targets {
+		m, err := newContainerMonitor(d.settings, target)
+		if err != nil {
+			fmt.Printf("Skipping container %s: %v\n", target.Container, err)
+			continue
+		}
+		d.group.start(ctx, m)
+	}
+	return nil
+}
+
+// newTargets lists the matching containers and returns the targets of the
+// ones not seen before.
+func (d *discovery) newTargets() ([]targetConfig, error) {
+	containers, err := helpers.ListContainers(d.settings.client, d.settings.baseDockerURL, d.selector)
+	if err != nil {
+		return nil, err
+	}
+	var targets []targetConfig
+	for _, c := range containers {
+		if d.known[c.Name()] {
+			continue
+		}
+		d.known[c.Name()] = true
+
+		target, err := targetFromLabels(c.Name(), c.Labels, d.defaults)
+		if err != nil {
+			fmt.Printf("Skipping container %s: %v\n", c.Name(), err)
+			continue
+		}
+		fmt.Printf("Discovered container %s (%s), threshold %s, process %s, dump tool %s\n", target.Container, shortID(c.ID), target.Threshold, target.Process, target.DumpTool)
+		targets = append(targets, target)
+	}
+	return targets, nil
+}
+
+// targetFromLabels builds the target of a discovered container, applying the
+// ram-dumper.* label overrides on top of the defaults.
+func targetFromLabels(name string, labels map[string]string, defaults targetConfig) (targetConfig, error) {
+	target := defaults
+	target.Container = name
+	if threshold, ok := labels[labelPrefix+"threshold"]; ok {
+		target.Threshold = threshold
+	}
+	if process, ok := labels[labelPrefix+"process"]; ok {
+		target.Process = process
+	}
+	if dumpTool, ok := labels[labelPrefix+"dump-tool"]; ok {
+		target.DumpTool = dumpTool
+	}
+	if dumpType, ok := labels[labelPrefix+"dump-type"]; ok {
+		target.DumpType = dumpType
+	}
+	if growth, ok := labels[labelPrefix+"growth"]; ok {
+		target.Growth = growth
+	}
+	if oomHorizon, ok := labels[labelPrefix+"oom-horizon"]; ok {
+		target.OOMHorizon = oomHorizon
+	}
+	if seriesStep, ok := labels[labelPrefix+"series-step"]; ok {
+		target.SeriesStep = seriesStep
+	}
+	if seriesInterval, ok := labels[labelPrefix+"series-interval"]; ok {
+		target.SeriesInterval = seriesInterval
+	}
+	if cooldown, ok := labels[labelPrefix+"cooldown"]; ok {
+		target.Cooldown = cooldown
+	}
+	if rearm, ok := labels[labelPrefix+"rearm"]; ok {
+		target.Rearm = rearm
+	}
+	if runtimeCounters, ok := labels[labelPrefix+"runtime-counters"]; ok {
+		target.RuntimeCounters = runtimeCounters
+	}
+	if dumpsCount, ok := labels[labelPrefix+"dumps-count"]; ok {
+		count, err := strconv.Atoi(dumpsCount)
+		if err != nil {
+			return target, fmt.Errorf("invalid %sdumps-count label %q: %v", labelPrefix, dumpsCount, err)
+		}
+		target.DumpsCount = count
+	}
+	return target, nil
+}
+
+func shortID(id string) string {
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
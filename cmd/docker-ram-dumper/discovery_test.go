@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func TestTargetFromLabels(t *testing.T) {
+	labels := map[string]string{
+		"ram-dumper.enabled":     "true",
+		"ram-dumper.threshold":   "85%",
+		"ram-dumper.process":     "nethermind",
+		"ram-dumper.dump-tool":   "dotnet-dump",
+		"ram-dumper.dumps-count": "3",
+	}
+
+	target, err := targetFromLabels("sedge-node", labels, testTargetDefaults)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := targetConfig{Container: "sedge-node", Threshold: "85%", Process: "nethermind", DumpTool: "dotnet-dump", DumpsCount: 3}
+	if target != expected {
+		t.Errorf("Unexpected target: got %+v, want %+v", target, expected)
+	}
+
+	if _, err := targetFromLabels("sedge-node", map[string]string{"ram-dumper.dumps-count": "many"}, testTargetDefaults); err == nil {
+		t.Error("Expected an error for an invalid dumps-count label")
+	}
+}
+
+func TestListContainers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/json" || r.URL.Query().Get("filters") != `{"label":["ram-dumper.enabled=true"]}` {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		w.Write([]byte(`[{"Id":"0123456789abcdef","Names":["/sedge-node"],"State":"running","Labels":{"ram-dumper.enabled":"true"}}]`))
+	}))
+	defer server.Close()
+
+	containers, err := helpers.ListContainers(server.Client(), server.URL, []string{"ram-dumper.enabled=true"})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(containers) != 1 || containers[0].Name() != "sedge-node" || containers[0].ID != "0123456789abcdef" {
+		t.Errorf("Unexpected containers: %+v", containers)
+	}
+}
+
+func TestDiscoverRecreatedContainer(t *testing.T) {
+	containerID := "0123456789abcdef"
+	originalListContainers := helpers.ListContainers
+	helpers.ListContainers = func(client *http.Client, baseDockerURL string, labels []string) ([]helpers.ContainerSummary, error) {
+		return []helpers.ContainerSummary{{ID: containerID, Names: []string{"/sedge-node"}, State: "running"}}, nil
+	}
+	originalGetContainerMemoryUsage := helpers.GetContainerMemoryUsage
+	helpers.GetContainerMemoryUsage = func(client *http.Client, containerName, baseDockerURL string, printStats bool) (float64, uint64, error) {
+		return 50, 4096, nil
+	}
+	defer func() {
+		helpers.ListContainers = originalListContainers
+		helpers.GetContainerMemoryUsage = originalGetContainerMemoryUsage
+	}()
+
+	group := &monitorGroup{}
+	d := newDiscovery(monitorSettings{}, "ram-dumper.enabled=true", testTargetDefaults, group)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := d.discover(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// The container is recreated under the same name with a new ID, its
+	// monitor follows it through the start event
+	containerID = "fedcba9876543210"
+	if err := d.discover(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if monitors := group.wait(); len(monitors) != 1 {
+		t.Errorf("Expected a single monitor for the recreated container, got %d", len(monitors))
+	}
+}
+
+func TestDiscoveryNewTargets(t *testing.T) {
+	originalListContainers := helpers.ListContainers
+	helpers.ListContainers = func(client *http.Client, baseDockerURL string, labels []string) ([]helpers.ContainerSummary, error) {
+		return []helpers.ContainerSummary{
+			{ID: "0123456789abcdef", Names: []string{"/sedge-node"}, State: "running", Labels: map[string]string{"ram-dumper.dump-tool": "dotnet-dump"}},
+			{ID: "fedcba9876543210", Names: []string{"/sedge-cl"}, State: "running"},
+		}, nil
+	}
+	defer func() { helpers.ListContainers = originalListContainers }()
+
+	d := newDiscovery(monitorSettings{}, "ram-dumper.enabled=true", testTargetDefaults, nil)
+	targets, err := d.newTargets()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(targets) != 2 || targets[0].Container != "sedge-node" || targets[0].DumpTool != "dotnet-dump" || targets[1].Container != "sedge-cl" {
+		t.Errorf("Unexpected discovered targets: %+v", targets)
+	}
+	// Containers already discovered are not returned again
+	if targets, err := d.newTargets(); err != nil || len(targets) != 0 {
+		t.Errorf("Expected no new targets, got %+v (%v)", targets, err)
+	}
+}
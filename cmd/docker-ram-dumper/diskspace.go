@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"syscall"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// dumpSizeFactors estimate the size of a dump from the memory in use, by dump
+// type. Full dumps hold all of it, heap dumps most of it, mini and triage
+// dumps only thread stacks and a few pages around them.
+var dumpSizeFactors = map[string]float64{
+	dumpTypeFull:   1,
+	dumpTypeHeap:   0.8,
+	dumpTypeMini:   0.1,
+	dumpTypeTriage: 0.05,
+}
+
+// estimateDumpSizeMB returns the expected size of a dump of dumpType taken at
+// usageMB of memory. The tool default is estimated as a full dump.
+func estimateDumpSizeMB(usageMB float64, dumpType string) float64 {
+	factor, ok := dumpSizeFactors[dumpType]
+	if !ok {
+		factor = dumpSizeFactors[dumpTypeFull]
+	}
+	return usageMB * factor
+}
+
+// dumpSkippedError is returned when there is no room for any dump type the
+// tool supports.
+type dumpSkippedError struct {
+	reason string
+}
+
+func (e *dumpSkippedError) Error() string {
+	return e.reason
+}
+
+var hostFreeSpaceMB = func(dir string) (float64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, fmt.Errorf("failed to get free space of %s: %v", dir, err)
+	}
+	return float64(stat.Bavail) * float64(stat.Bsize) / 1024 / 1024, nil
+}
+
+// containerFreeSpaceMB runs df in the container and returns the free space of
+// the filesystem of dir and its type, e.g. "overlay" or "tmpfs".
+func containerFreeSpaceMB(client *http.Client, containerName, dir, baseDockerURL string) (float64, string, error) {
+	output, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "df", "-Pk", dir)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to run df in container: %v", err)
+	}
+	return parseDfAvailableMB(helpers.DemuxExecOutput(output))
+}
+
+// parseDfAvailableMB parses the last line of POSIX df output in 1K blocks:
+//
+//	Filesystem     1024-blocks      Used Available Capacity Mounted on
+//	overlay          102687672  52321232  45107220      54% /
+func parseDfAvailableMB(output string) (float64, string, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Fields(lines[len(lines)-1])
+	if len(lines) < 2 || len(fields) < 6 {
+		return 0, "", fmt.Errorf("unexpected df output: %s", output)
+	}
+	availableKB, err := strconv.ParseFloat(fields[3], 64)
+	if err != nil {
+		return 0, "", fmt.Errorf("unexpected df output: %s", output)
+	}
+	return availableKB / 1024, fields[0], nil
+}
+
+// planDump checks that the dump fits in the dump directories, keeping
+// -min-free-space free, and returns the dump type to capture. When the
+// configured type does not fit, it is downgraded to the next smaller type
+// the tool supports. captureThreshold is the usage the tool waits for.
+func (m *containerMonitor) planDump(captureThreshold float64) (string, error) {
+	usageMB := max(m.lastUsageMB, captureThreshold)
+
+	hostFree, err := hostFreeSpaceMB(m.settings.dumpDirHost)
+	if err != nil {
+		m.logf("Cannot check free space on the host: %v", err)
+		hostFree = math.Inf(1)
+	}
+	containerFree := math.Inf(1)
+	if !m.settings.hostMode {
+		free, filesystem, err := containerFreeSpaceMB(m.settings.client, m.target.Container, m.settings.dumpDirContainer, m.settings.baseDockerURL)
+		if err != nil {
+			m.logf("Cannot check free space in the container: %v", err)
+		} else {
+			containerFree = free
+			// Files written to tmpfs are charged to the container memory, a
+			// dump there can push the container over its limit
+			if filesystem == "tmpfs" && m.memoryLimitMB > 0 {
+				containerFree = min(free, float64(m.memoryLimitMB)-m.lastUsageMB)
+			}
+		}
+	}
+
+	requested := m.target.DumpType
+	candidates := dumpTypes
+	if requested != "" {
+		candidates = dumpTypes[slices.Index(dumpTypes, requested):]
+	}
+	var shortage string
+	first := true
+	for _, dumpType := range candidates {
+		if !slices.Contains(m.tool.DumpTypes(), dumpType) {
+			continue
+		}
+		sizeMB := estimateDumpSizeMB(usageMB, dumpType)
+		shortage = spaceShortage("the host dump directory", hostFree, sizeMB, m.settings.minFreeSpaceMB)
+		if shortage == "" {
+			// A dump larger than a copy chunk is copied in chunks cut next
+			// to it in the container
+			containerMB := sizeMB
+			if chunkMB := float64(m.copyChunkSize()) / (1024 * 1024); sizeMB > chunkMB {
+				containerMB += chunkMB
+			}
+			shortage = spaceShortage("the container dump directory", containerFree, containerMB, m.settings.minFreeSpaceMB)
+		}
+		if shortage == "" {
+			if first {
+				return requested, nil
+			}
+			m.logf("Downgrading the dump to %s (about %.0f MB) for lack of space", dumpType, sizeMB)
+			return dumpType, nil
+		}
+		m.logf("No room for a %s dump: %s", dumpType, shortage)
+		first = false
+	}
+	return "", &dumpSkippedError{reason: "not enough space for any dump type: " + shortage}
+}
+
+func spaceShortage(where string, freeMB, sizeMB, minFreeMB float64) string {
+	if freeMB-sizeMB >= minFreeMB {
+		return ""
+	}
+	return fmt.Sprintf("%s has %.0f MB free, the dump needs about %.0f MB and %.0f MB must stay free", where, freeMB, sizeMB, minFreeMB)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func TestParseDfAvailableMB(t *testing.T) {
+	output := "Filesystem     1024-blocks      Used Available Capacity Mounted on\noverlay          102687672  52321232  45107220      54% /\n"
+	free, filesystem, err := parseDfAvailableMB(output)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if free != 45107220.0/1024 || filesystem != "overlay" {
+		t.Errorf("Unexpected df result: %.2f MB on %s", free, filesystem)
+	}
+	if _, _, err := parseDfAvailableMB("df: /tmp/dumps: No such file or directory"); err == nil {
+		t.Error("Expected an error for a df failure")
+	}
+}
+
+func TestContainerFreeSpaceMB(t *testing.T) {
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		// The data line is split across two frames
+		return execFrame("Filesystem     1024-blocks      Used Available Capacity Mounted on\noverlay") +
+			execFrame("          102687672  52321232  45107220      54% /\n"), nil
+	}
+	defer func() { helpers.ExecInContainer = originalExecInContainer }()
+
+	free, filesystem, err := containerFreeSpaceMB(nil, "test-container", "/tmp/dumps", "http://localhost")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if free != 45107220.0/1024 || filesystem != "overlay" {
+		t.Errorf("Unexpected df result: %.2f MB on %s", free, filesystem)
+	}
+}
+
+func TestPlanDump(t *testing.T) {
+	var containerDf string
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		return containerDf, nil
+	}
+	hostFree := 100000.0
+	originalHostFreeSpaceMB := hostFreeSpaceMB
+	hostFreeSpaceMB = func(dir string) (float64, error) {
+		return hostFree, nil
+	}
+	defer func() {
+		helpers.ExecInContainer = originalExecInContainer
+		hostFreeSpaceMB = originalHostFreeSpaceMB
+	}()
+
+	copyChunkSize := int64(256 * 1024 * 1024)
+	newMonitor := func(dumpTool, dumpType string) *containerMonitor {
+		target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: dumpTool, DumpType: dumpType, DumpsCount: 1}
+		m, err := newContainerMonitor(monitorSettings{minFreeSpaceMB: 1024, copyChunkSize: copyChunkSize}, target)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		m.memoryLimitMB = 16384
+		m.lastUsageMB = 8192
+		return m
+	}
+
+	// 20 GB free in the container, 100 GB on the host
+	containerDf = "Filesystem 1024-blocks Used Available Capacity Mounted on\noverlay 104857600 83886080 20971520 80% /\n"
+	if dumpType, err := newMonitor("procdump", "").planDump(0); err != nil || dumpType != "" {
+		t.Errorf("Expected the default dump type, got %q (%v)", dumpType, err)
+	}
+
+	// 8 GB free on the host, a full dump and the reserve do not fit
+	hostFree = 8192
+	if dumpType, err := newMonitor("procdump", dumpTypeFull).planDump(0); err != nil || dumpType != dumpTypeMini {
+		t.Errorf("Expected a downgrade to a mini dump, got %q (%v)", dumpType, err)
+	}
+	if dumpType, err := newMonitor("dotnet-dump", dumpTypeFull).planDump(0); err != nil || dumpType != dumpTypeHeap {
+		t.Errorf("Expected a downgrade to a heap dump, got %q (%v)", dumpType, err)
+	}
+	var skipped *dumpSkippedError
+	if _, err := newMonitor("gcore", "").planDump(0); !errors.As(err, &skipped) {
+		t.Errorf("Expected the gcore dump to be skipped, got %v", err)
+	}
+
+	// 12 GB free in the container, the full dump fits but not next to the
+	// 4 GB chunks it is copied in
+	hostFree = 100000
+	containerDf = "Filesystem 1024-blocks Used Available Capacity Mounted on\noverlay 104857600 92274688 12582912 88% /\n"
+	if dumpType, err := newMonitor("procdump", dumpTypeFull).planDump(0); err != nil || dumpType != dumpTypeFull {
+		t.Errorf("Expected a full dump with 256 MB chunks, got %q (%v)", dumpType, err)
+	}
+	copyChunkSize = 4096 * 1024 * 1024
+	if dumpType, err := newMonitor("procdump", dumpTypeFull).planDump(0); err != nil || dumpType != dumpTypeMini {
+		t.Errorf("Expected a downgrade to a mini dump with 4 GB chunks, got %q (%v)", dumpType, err)
+	}
+	copyChunkSize = 256 * 1024 * 1024
+
+	// A dump written to tmpfs is limited by the 8 GB of memory left in the container
+	hostFree = 100000
+	containerDf = "Filesystem 1024-blocks Used Available Capacity Mounted on\ntmpfs 33554432 0 33554432 0% /tmp\n"
+	if dumpType, err := newMonitor("dotnet-dump", "").planDump(0); err != nil || dumpType != dumpTypeHeap {
+		t.Errorf("Expected a downgrade to a heap dump on tmpfs, got %q (%v)", dumpType, err)
+	}
+}
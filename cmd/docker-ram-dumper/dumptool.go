@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// dumpTarget identifies the container a dump tool works with.
+type dumpTarget struct {
+	client        *http.Client
+	containerName string
+	baseDockerURL string
+}
+
+// Dump types selected with -dump-type. Each tool maps them to its own
+// options, an empty dump type keeps the tool default.
+const (
+	dumpTypeFull   = "full"
+	dumpTypeHeap   = "heap"
+	dumpTypeMini   = "mini"
+	dumpTypeTriage = "triage"
+)
+
+var dumpTypes = []string{dumpTypeFull, dumpTypeHeap, dumpTypeMini, dumpTypeTriage}
+
+// dumpRequest describes a single memory dump to capture.
+type dumpRequest struct {
+	dumpTarget
+	// ctx cancels the wait for the memory threshold
+	ctx                  context.Context
+	pid                  int
+	dumpFile             string
+	totalMemoryThreshold float64
+	checkInterval        time.Duration
+	dumpType             string
+}
+
+// DumpTool is implemented by every supported memory dump tool.
+type DumpTool interface {
+	// Name returns the value used to select the tool with the -dump-tool flag.
+	Name() string
+	// Detect reports whether the tool is already available in the container.
+	Detect(target dumpTarget) (string, bool)
+	// Install installs the tool inside the container.
+	Install(target dumpTarget) (string, error)
+	// Version returns the version of the tool in the container, or an
+	// empty string when it cannot be determined.
+	Version(target dumpTarget) string
+	// DumpTypes returns the dump types the tool can capture, the first one
+	// being what the tool captures by default.
+	DumpTypes() []string
+	// Capture creates the memory dump and returns the tool output.
+	Capture(req dumpRequest) (string, error)
+	// OutputFiles returns the paths of the files the tool writes for dumpFile.
+	OutputFiles(dumpFile string, pid int) []string
+	// Cleanup stops any tool process left running in the container.
+	Cleanup(target dumpTarget) error
+}
+
+var dumpTools = map[string]DumpTool{}
+
+// registerDumpTool makes a dump tool available to the -dump-tool flag.
+func registerDumpTool(tool DumpTool) {
+	dumpTools[tool.Name()] = tool
+}
+
+func getDumpTool(name string) (DumpTool, error) {
+	tool, ok := dumpTools[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported dump tool: %s (supported: %s)", name, strings.Join(dumpToolNames(), ", "))
+	}
+	return tool, nil
+}
+
+func dumpToolNames() []string {
+	names := make([]string, 0, len(dumpTools))
+	for name := range dumpTools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func installDumpTool(client *http.Client, containerName, dumpTool, baseDockerURL string) (string, error) {
+	tool, err := getDumpTool(dumpTool)
+	if err != nil {
+		return "", err
+	}
+	target := dumpTarget{client: client, containerName: containerName, baseDockerURL: baseDockerURL}
+	if which, ok := tool.Detect(target); ok {
+		fmt.Printf("%s is already installed: %s\n", tool.Name(), which)
+		return which, nil
+	}
+	fmt.Printf("%s not found. Installing...\n", tool.Name())
+	result, err := tool.Install(target)
+	if err != nil {
+		return "", fmt.Errorf("error installing %s: %v", tool.Name(), err)
+	}
+	fmt.Printf("%s installed successfully.\n", tool.Name())
+	return result, nil
+}
+
+func createMemoryDump(ctx context.Context, client *http.Client, containerName, dumpTool string, pid int, dumpFile string, totalMemoryThreshold float64, baseDockerURL string, checkInterval time.Duration, dumpType string) (string, error) {
+	tool, err := getDumpTool(dumpTool)
+	if err != nil {
+		return "", err
+	}
+	return tool.Capture(dumpRequest{
+		dumpTarget:           dumpTarget{client: client, containerName: containerName, baseDockerURL: baseDockerURL},
+		ctx:                  ctx,
+		pid:                  pid,
+		dumpFile:             dumpFile,
+		totalMemoryThreshold: totalMemoryThreshold,
+		checkInterval:        checkInterval,
+		dumpType:             dumpType,
+	})
+}
+
+// dotnetCollector is implemented by the .NET dump tools, which attach to the
+// runtime and therefore wait for the threshold themselves instead of relying
+// on a tool-side trigger like procdump -M.
+type dotnetCollector interface {
+	collect(req dumpRequest) (string, error)
+}
+
+func createDotnetDump(ctx context.Context, client *http.Client, containerName string, pid int, dumpFile string, totalMemoryThreshold float64, baseDockerURL string, checkInterval time.Duration, tool, dumpType string) (string, error) {
+	dumpTool, err := getDumpTool(tool)
+	if err != nil {
+		return "", err
+	}
+	collector, ok := dumpTool.(dotnetCollector)
+	if !ok {
+		return "", fmt.Errorf("%s is not a .NET dump tool", tool)
+	}
+	req := dumpRequest{
+		dumpTarget:           dumpTarget{client: client, containerName: containerName, baseDockerURL: baseDockerURL},
+		ctx:                  ctx,
+		pid:                  pid,
+		dumpFile:             dumpFile,
+		totalMemoryThreshold: totalMemoryThreshold,
+		checkInterval:        checkInterval,
+		dumpType:             dumpType,
+	}
+	if err := waitForMemoryThreshold(req); err != nil {
+		return "", err
+	}
+	return collector.collect(req)
+}
+
+// waitForMemoryThreshold blocks until the container memory usage reaches the
+// request threshold. It is used by tools that capture a dump immediately when
+// started and have no trigger of their own. A threshold of 0 does not wait.
+// The wait ends with an error when the request context is done.
+func waitForMemoryThreshold(req dumpRequest) error {
+	if req.totalMemoryThreshold <= 0 {
+		return nil
+	}
+	for {
+		memUsagePercent, memoryLimitMB, err := helpers.GetContainerMemoryUsage(req.client, req.containerName, req.baseDockerURL, false)
+		if err != nil {
+			return fmt.Errorf("failed to get memory usage: %v", err)
+		}
+		memoryUsageMB := memUsagePercent * float64(memoryLimitMB) / 100
+
+		if memoryUsageMB >= req.totalMemoryThreshold {
+			return nil
+		}
+		fmt.Printf("Memory usage is %.2f%% (%.0f MB). Waiting for memory usage to exceed %.0f MB...\n",
+			memUsagePercent,
+			memoryUsageMB,
+			req.totalMemoryThreshold)
+
+		select {
+		case <-req.ctx.Done():
+			return fmt.Errorf("stopped waiting for memory usage to exceed %.0f MB: %v", req.totalMemoryThreshold, req.ctx.Err())
+		case <-time.After(req.checkInterval):
+		}
+	}
+}
+
+// versionLine returns the first line of a version command output containing
+// match, or an empty string. Exec output is demultiplexed first.
+func versionLine(output, match string) string {
+	for _, line := range strings.Split(helpers.DemuxExecOutput(output), "\n") {
+		if line = strings.TrimSpace(line); strings.Contains(line, match) {
+			return line
+		}
+	}
+	return ""
+}
+
+func killProcess(client *http.Client, containerName, processName, baseDockerURL string) error {
+	processes, _ := helpers.ExecInContainer(client, containerName, baseDockerURL, "ps", "aux")
+	fmt.Println("Active processes:\n", processes)
+	_, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "pkill", "-f", processName)
+	if err != nil {
+		return fmt.Errorf("error killing process: %v", err)
+	} else {
+		fmt.Println("Successfully killed " + processName + " process.")
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func init() {
+	registerDumpTool(dotMemoryTool{})
+}
+
+const dotMemoryPath = "/dotMemoryclt/dotmemory"
+
+// dotMemoryTool captures snapshots with the JetBrains dotMemory console profiler.
+type dotMemoryTool struct{}
+
+func (dotMemoryTool) Name() string { return "dotMemory" }
+
+func (dotMemoryTool) Detect(target dumpTarget) (string, bool) {
+	which, err := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "ls", dotMemoryPath)
+	return which, err == nil && !strings.Contains(which, "No such file or directory")
+}
+
+func (dotMemoryTool) Install(target dumpTarget) (string, error) {
+	dockerArch := "linux-arm64"
+	if runtime.GOARCH == "amd64" {
+		dockerArch = "linux-x64"
+	} else if runtime.GOARCH == "arm64" {
+		dockerArch = "linux-arm64"
+	}
+	return helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "sh", "-c", "apt-get update && apt-get install -y curl && curl -L -o dotMemory.tar.gz https://download.jetbrains.com/resharper/dotUltimate."+dotMemoryVersion+"/JetBrains.dotMemory.Console."+dockerArch+"."+dotMemoryVersion+".tar.gz && mkdir -p /dotMemoryclt && tar -xzf dotMemory.tar.gz -C /dotMemoryclt && chmod +x -R /dotMemoryclt/*")
+}
+
+func (t dotMemoryTool) Capture(req dumpRequest) (string, error) {
+	return createDotnetDump(req.ctx, req.client, req.containerName, req.pid, req.dumpFile, req.totalMemoryThreshold, req.baseDockerURL, req.checkInterval, t.Name(), req.dumpType)
+}
+
+// Version is the one installed with -dotmemory-version.
+func (dotMemoryTool) Version(dumpTarget) string {
+	return dotMemoryVersion
+}
+
+// DumpTypes maps full to a profiling session workspace, attached to the
+// process, and heap to a single standalone snapshot.
+func (dotMemoryTool) DumpTypes() []string {
+	return []string{dumpTypeFull, dumpTypeHeap}
+}
+
+func (dotMemoryTool) collect(req dumpRequest) (string, error) {
+	cmd := []string{dotMemoryPath, "attach", fmt.Sprintf("%d", req.pid), "--save-to-file=" + req.dumpFile, "--overwrite", "--trigger-on-activation", "--timeout=" + dotMemoryTimeout}
+	if req.dumpType == dumpTypeHeap {
+		cmd = []string{dotMemoryPath, "get-snapshot", fmt.Sprintf("%d", req.pid), "--save-to-file=" + req.dumpFile, "--overwrite"}
+	}
+	fmt.Println("Executing command:", cmd)
+	output, err := helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, cmd...)
+	// if unrecognized address, try to run dotmemory again
+	const maxRetries = 5
+	retryCount := 0
+	for (strings.Contains(output, "unrecognized address") || strings.Contains(output, "Object reference not set to an instance of an object") || strings.Contains(output, "Non-writeable path")) && retryCount < maxRetries {
+		fmt.Printf("Retrying command (attempt %d of %d)...\n", retryCount+1, maxRetries)
+		if strings.Contains(output, "-writeable path") {
+			// remove dump directory
+			fmt.Println("Removing dump directory...")
+			helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, "rm", "-rf", "/tmp/dumps")
+			time.Sleep(2 * time.Second)
+		}
+		output, err = helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, cmd...)
+		retryCount++
+		if err != nil {
+			fmt.Printf("Cannot save memory dump. Attempt %d failed: %v\n", retryCount, err)
+		}
+		time.Sleep(2 * time.Second) // Add small delay between retries
+	}
+	fmt.Println("dotMemory output:", output)
+	files, _ := helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, "ls", "-l", "/tmp/dumps")
+	fmt.Println("Files in /tmp/dumps:", files)
+	return output, err
+}
+
+// OutputFiles accounts for dotMemory appending the ".dmw" workspace extension.
+func (dotMemoryTool) OutputFiles(dumpFile string, _ int) []string {
+	return []string{dumpFile + ".dmw"}
+}
+
+func (t dotMemoryTool) Cleanup(target dumpTarget) error {
+	return killProcess(target.client, target.containerName, t.Name(), target.baseDockerURL)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func init() {
+	registerDumpTool(dotnetDumpTool{})
+}
+
+const dotnetDumpPath = "/root/.dotnet/tools/dotnet-dump"
+
+// dotnetDumpTool captures dumps with the dotnet-dump global tool.
+type dotnetDumpTool struct{}
+
+func (dotnetDumpTool) Name() string { return "dotnet-dump" }
+
+func (dotnetDumpTool) Detect(target dumpTarget) (string, bool) {
+	which, err := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "ls", dotnetDumpPath)
+	return which, err == nil && !strings.Contains(which, "No such file or directory")
+}
+
+func (dotnetDumpTool) Install(target dumpTarget) (string, error) {
+	return helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "sh", "-c", "apt-get update && apt-get install -y dotnet-sdk-8.0 curl && curl -sSL https://dot.net/v1/dotnet-install.sh -o dotnet-install.sh && chmod +x dotnet-install.sh && ./dotnet-install.sh --channel 8.0 --install-dir /root/.dotnet && dotnet tool install --global dotnet-dump")
+}
+
+func (t dotnetDumpTool) Capture(req dumpRequest) (string, error) {
+	return createDotnetDump(req.ctx, req.client, req.containerName, req.pid, req.dumpFile, req.totalMemoryThreshold, req.baseDockerURL, req.checkInterval, t.Name(), req.dumpType)
+}
+
+// dotnetDumpTypes maps the dump types to the dotnet-dump --type values, the
+// diagnostics IPC dump types and the createdump options.
+var dotnetDumpTypes = map[string]struct {
+	collectType    string
+	diagnosticType uint32
+	createdumpFlag string
+}{
+	dumpTypeFull:   {"Full", diagnosticsDumpFull, "--full"},
+	dumpTypeHeap:   {"Heap", diagnosticsDumpHeap, "--withheap"},
+	dumpTypeMini:   {"Mini", diagnosticsDumpMini, "--normal"},
+	dumpTypeTriage: {"Triage", diagnosticsDumpTriage, "--triage"},
+}
+
+func (dotnetDumpTool) Version(target dumpTarget) string {
+	output, err := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, dotnetDumpPath, "--version")
+	if err != nil {
+		return ""
+	}
+	return versionLine(output, ".")
+}
+
+func (dotnetDumpTool) DumpTypes() []string {
+	return dumpTypes
+}
+
+func (dotnetDumpTool) collect(req dumpRequest) (string, error) {
+	cmd := []string{dotnetDumpPath, "collect", "-p", fmt.Sprintf("%d", req.pid), "-o", req.dumpFile}
+	if req.dumpType != "" {
+		cmd = append(cmd, "--type", dotnetDumpTypes[req.dumpType].collectType)
+	}
+	return helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, cmd...)
+}
+
+// CaptureHost asks the runtime of the target process for a dump over its
+// diagnostics IPC socket, reached through the container root filesystem.
+// Without a socket it runs the createdump utility shipped with the runtime
+// inside the mount and PID namespaces of the process instead. Either way the
+// runtime writes the dump to /tmp of the container, from where it is moved
+// into the host dump directory right away.
+func (dotnetDumpTool) CaptureHost(req hostDumpRequest) (string, error) {
+	if err := waitForMemoryThreshold(req.dumpRequest); err != nil {
+		return "", err
+	}
+	tmpDir, err := containerTmpDir(hostProcRoot, req.hostPID)
+	if err != nil {
+		return "", err
+	}
+	containerFile := "/tmp/" + filepath.Base(req.dumpFile)
+	hostFile := filepath.Join(tmpDir, filepath.Base(req.dumpFile))
+	dumpType, ok := dotnetDumpTypes[req.dumpType]
+	if !ok {
+		dumpType = dotnetDumpTypes[dumpTypeFull]
+	}
+	var output string
+	socket, err := diagnosticsSocket(hostProcRoot, req.hostPID, req.pid)
+	if err == nil {
+		fmt.Printf("Requesting dump through diagnostics socket %s\n", socket)
+		if err := createDiagnosticsDump(socket, containerFile, dumpType.diagnosticType); err != nil {
+			os.Remove(hostFile)
+			return "", err
+		}
+		output = "Dump written by the runtime to " + containerFile
+	} else {
+		fmt.Printf("%v, falling back to createdump\n", err)
+		createdump, err := findCreatedump(hostProcRoot, req.hostPID)
+		if err != nil {
+			return "", err
+		}
+		output, err = runHostCommand("nsenter", "-t", strconv.Itoa(req.hostPID), "-m", "-p", "--", createdump, dumpType.createdumpFlag, "-f", containerFile, strconv.Itoa(req.pid))
+		if err != nil {
+			os.Remove(hostFile)
+			return output, err
+		}
+	}
+	if err := moveFile(hostFile, req.dumpFile); err != nil {
+		os.Remove(hostFile)
+		return output, err
+	}
+	return output, nil
+}
+
+// HostVersion returns the version of the .NET runtime of the process, which
+// writes the dump in host mode.
+func (dotnetDumpTool) HostVersion(hostPID int) string {
+	coreclr, err := findCoreCLR(hostProcRoot, hostPID)
+	if err != nil {
+		return ""
+	}
+	return ".NET runtime " + filepath.Base(filepath.Dir(coreclr))
+}
+
+// containerTmpDir returns /tmp of the container of hostPID as seen from the
+// host, after checking that the runtime can write a dump to it. Images with a
+// read-only root filesystem need a tmpfs mounted on /tmp for host mode.
+func containerTmpDir(procRoot string, hostPID int) (string, error) {
+	dir := filepath.Join(procRoot, strconv.Itoa(hostPID), "root", "tmp")
+	probe, err := os.CreateTemp(dir, ".ram-dumper-")
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return "", fmt.Errorf("container of process %d has no /tmp to write the dump to", hostPID)
+	case errors.Is(err, syscall.EROFS):
+		return "", fmt.Errorf("/tmp of the container of process %d is read-only, mount a tmpfs on /tmp to capture dumps in host mode", hostPID)
+	case err != nil:
+		return "", fmt.Errorf("cannot write the dump to /tmp of the container of process %d: %v", hostPID, err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return dir, nil
+}
+
+// findCreatedump locates createdump next to the libcoreclr.so mapped by the process.
+func findCreatedump(procRoot string, hostPID int) (string, error) {
+	coreclr, err := findCoreCLR(procRoot, hostPID)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(filepath.Dir(coreclr), "createdump"), nil
+}
+
+// findCoreCLR returns the path of the libcoreclr.so mapped by the process.
+func findCoreCLR(procRoot string, hostPID int) (string, error) {
+	maps, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(hostPID), "maps"))
+	if err != nil {
+		return "", fmt.Errorf("failed to read memory maps of process %d: %v", hostPID, err)
+	}
+	for _, line := range strings.Split(string(maps), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || filepath.Base(fields[len(fields)-1]) != "libcoreclr.so" {
+			continue
+		}
+		return fields[len(fields)-1], nil
+	}
+	return "", fmt.Errorf("process %d is not a .NET process: libcoreclr.so is not loaded", hostPID)
+}
+
+func (dotnetDumpTool) OutputFiles(dumpFile string, _ int) []string {
+	return []string{dumpFile}
+}
+
+func (t dotnetDumpTool) Cleanup(target dumpTarget) error {
+	return killProcess(target.client, target.containerName, t.Name(), target.baseDockerURL)
+}
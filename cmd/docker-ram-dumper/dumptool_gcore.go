@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func init() {
+	registerDumpTool(gcoreTool{})
+}
+
+// gcoreTool captures native ELF core dumps with gdb's gcore, which works for
+// any process (Go, Rust, C++, ...) regardless of its runtime.
+type gcoreTool struct{}
+
+func (gcoreTool) Name() string { return "gcore" }
+
+func (gcoreTool) Detect(target dumpTarget) (string, bool) {
+	which, err := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "which", "gcore")
+	return which, err == nil && strings.TrimSpace(which) != ""
+}
+
+func (gcoreTool) Install(target dumpTarget) (string, error) {
+	return helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "sh", "-c", "apk add --no-cache gdb || (apt-get update && apt-get install -y gdb)")
+}
+
+func (gcoreTool) Version(target dumpTarget) string {
+	output, _ := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "gdb", "--version")
+	return versionLine(output, "GNU gdb")
+}
+
+// DumpTypes is limited to full dumps, gcore writes the whole core image.
+func (gcoreTool) DumpTypes() []string {
+	return []string{dumpTypeFull}
+}
+
+func (gcoreTool) Capture(req dumpRequest) (string, error) {
+	if err := waitForMemoryThreshold(req); err != nil {
+		return "", err
+	}
+	cmd := []string{"gcore", "-o", req.dumpFile, fmt.Sprintf("%d", req.pid)}
+	return helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, cmd...)
+}
+
+func (gcoreTool) CaptureHost(req hostDumpRequest) (string, error) {
+	if err := waitForMemoryThreshold(req.dumpRequest); err != nil {
+		return "", err
+	}
+	return runHostCommand("gcore", "-o", req.dumpFile, strconv.Itoa(req.hostPID))
+}
+
+// HostVersion returns the version of the gdb installed next to the dumper,
+// which runs gcore in host mode.
+func (gcoreTool) HostVersion(int) string {
+	output, _ := runHostCommand("gdb", "--version")
+	return versionLine(output, "GNU gdb")
+}
+
+// OutputFiles accounts for gcore appending ".<pid>" to the output prefix.
+func (gcoreTool) OutputFiles(dumpFile string, pid int) []string {
+	return []string{dumpFile + "." + strconv.Itoa(pid)}
+}
+
+// Cleanup kills gdb as well, since gcore is a wrapper script around it.
+func (t gcoreTool) Cleanup(target dumpTarget) error {
+	if err := killProcess(target.client, target.containerName, t.Name(), target.baseDockerURL); err != nil {
+		return err
+	}
+	return killProcess(target.client, target.containerName, "gdb", target.baseDockerURL)
+}
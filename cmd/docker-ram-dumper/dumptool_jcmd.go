@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func init() {
+	registerDumpTool(jcmdTool{})
+}
+
+// jcmdTool captures JVM heap dumps with jcmd, falling back to jmap when the
+// attach mechanism used by jcmd is not available.
+type jcmdTool struct{}
+
+func (jcmdTool) Name() string { return "jcmd" }
+
+func (jcmdTool) Detect(target dumpTarget) (string, bool) {
+	which, err := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "sh", "-c", "command -v jcmd || command -v jmap")
+	return which, err == nil && strings.TrimSpace(which) != ""
+}
+
+func (jcmdTool) Install(target dumpTarget) (string, error) {
+	return helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "sh", "-c", "apk add --no-cache openjdk17-jdk || (apt-get update && apt-get install -y default-jdk-headless)")
+}
+
+// Version returns the version of the JVM the heap dump comes from.
+func (jcmdTool) Version(target dumpTarget) string {
+	output, _ := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "sh", "-c", "java -version 2>&1")
+	return versionLine(output, "version")
+}
+
+// DumpTypes is limited to heap dumps, the only kind of dump of a JVM.
+func (jcmdTool) DumpTypes() []string {
+	return []string{dumpTypeHeap}
+}
+
+func (t jcmdTool) Capture(req dumpRequest) (string, error) {
+	if err := waitForMemoryThreshold(req); err != nil {
+		return "", err
+	}
+	hprofFile := t.OutputFiles(req.dumpFile, req.pid)[0]
+	pid := fmt.Sprintf("%d", req.pid)
+
+	output, err := helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, "jcmd", pid, "GC.heap_dump", hprofFile)
+	if err == nil && strings.Contains(output, "Heap dump file created") {
+		return output, nil
+	}
+	fmt.Printf("jcmd failed to create heap dump, falling back to jmap. Output: %s\n", output)
+	return helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, "jmap", "-dump:live,format=b,file="+hprofFile, pid)
+}
+
+// OutputFiles replaces the dump extension with ".hprof", the format both jcmd
+// and jmap write.
+func (jcmdTool) OutputFiles(dumpFile string, _ int) []string {
+	return []string{strings.TrimSuffix(dumpFile, ".dmp") + ".hprof"}
+}
+
+func (t jcmdTool) Cleanup(target dumpTarget) error {
+	return killProcess(target.client, target.containerName, t.Name(), target.baseDockerURL)
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func init() {
+	registerDumpTool(procdumpTool{})
+}
+
+// procdumpTool captures dumps with Sysinternals ProcDump for Linux.
+type procdumpTool struct{}
+
+func (procdumpTool) Name() string { return "procdump" }
+
+func (procdumpTool) Detect(target dumpTarget) (string, bool) {
+	which, err := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "which", "procdump")
+	return which, err == nil
+}
+
+func (procdumpTool) Install(target dumpTarget) (string, error) {
+	return helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "sh", "-c", "apk add --no-cache procdump || apt-get update && apt-get install -y procdump")
+}
+
+func (procdumpTool) Version(target dumpTarget) string {
+	output, _ := helpers.ExecInContainer(target.client, target.containerName, target.baseDockerURL, "procdump", "-h")
+	return versionLine(output, "ProcDump v")
+}
+
+func (procdumpTool) DumpTypes() []string {
+	return []string{dumpTypeFull, dumpTypeMini}
+}
+
+func (procdumpTool) Capture(req dumpRequest) (string, error) {
+	cmd := []string{"procdump", "-d", "-n", "1", "-s", "1"}
+	// procdump writes full core dumps unless asked for a minimal one
+	if req.dumpType == dumpTypeMini {
+		cmd = append(cmd, "-mp")
+	}
+	// Without a memory trigger procdump captures the dump right away
+	if req.totalMemoryThreshold > 0 {
+		cmd = append(cmd, "-M", fmt.Sprintf("%.0f", req.totalMemoryThreshold))
+	}
+	cmd = append(cmd, "-p", fmt.Sprintf("%d", req.pid), "-o", req.dumpFile)
+	return helpers.ExecInContainer(req.client, req.containerName, req.baseDockerURL, cmd...)
+}
+
+// OutputFiles accounts for procdump appending "_<index>.<pid>" to the file name.
+func (procdumpTool) OutputFiles(dumpFile string, pid int) []string {
+	return []string{dumpFile + "_0." + strconv.Itoa(pid)}
+}
+
+func (t procdumpTool) Cleanup(target dumpTarget) error {
+	return killProcess(target.client, target.containerName, t.Name(), target.baseDockerURL)
+}
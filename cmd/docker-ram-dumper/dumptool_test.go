@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func TestGetDumpTool(t *testing.T) {
+	for _, name := range []string{"procdump", "dotnet-dump", "dotMemory", "gcore", "jcmd"} {
+		tool, err := getDumpTool(name)
+		if err != nil {
+			t.Fatalf("Expected %s to be registered, got %v", name, err)
+		}
+		if tool.Name() != name {
+			t.Errorf("Unexpected tool name: got %q, want %q", tool.Name(), name)
+		}
+	}
+
+	if _, err := getDumpTool("unknown"); err == nil {
+		t.Error("Expected an error for an unknown dump tool")
+	}
+}
+
+func TestDumpToolOutputFiles(t *testing.T) {
+	dumpFile := "/tmp/dumps/core_1234_1.dmp"
+	tests := []struct {
+		tool string
+		want []string
+	}{
+		{"procdump", []string{dumpFile + "_0.1234"}},
+		{"dotnet-dump", []string{dumpFile}},
+		{"dotMemory", []string{dumpFile + ".dmw"}},
+		{"gcore", []string{dumpFile + ".1234"}},
+		{"jcmd", []string{"/tmp/dumps/core_1234_1.hprof"}},
+	}
+
+	for _, tt := range tests {
+		tool, err := getDumpTool(tt.tool)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if got := tool.OutputFiles(dumpFile, 1234); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: unexpected output files: got %v, want %v", tt.tool, got, tt.want)
+		}
+	}
+}
+
+func TestCreateMemoryDumpGcore(t *testing.T) {
+	server, client := mockExecInContainer("gcore output")
+	defer server.Close()
+
+	originalGetContainerMemoryUsage := helpers.GetContainerMemoryUsage
+	helpers.GetContainerMemoryUsage = func(client *http.Client, containerName, baseDockerURL string, getTotalMemory bool) (float64, uint64, error) {
+		return 95.0, 1900, nil // Simulating memory usage above threshold
+	}
+	defer func() {
+		helpers.GetContainerMemoryUsage = originalGetContainerMemoryUsage
+	}()
+
+	dumpFile := "/tmp/dumps/test.dmp"
+	_, err := createMemoryDump(context.Background(), client, "test-container", "gcore", 1234, dumpFile, 1800.0, server.URL, time.Second, "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expectedOutput := "gcore -o " + dumpFile + " 1234"
+	if string(testBodyOutput) != expectedOutput {
+		t.Errorf("Unexpected output: got %q, want %q", string(testBodyOutput), expectedOutput)
+	}
+}
+
+func TestCreateMemoryDumpJcmdFallsBackToJmap(t *testing.T) {
+	originalGetContainerMemoryUsage := helpers.GetContainerMemoryUsage
+	helpers.GetContainerMemoryUsage = func(client *http.Client, containerName, baseDockerURL string, getTotalMemory bool) (float64, uint64, error) {
+		return 95.0, 1900, nil // Simulating memory usage above threshold
+	}
+	var commands []string
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		commands = append(commands, strings.Join(command, " "))
+		if command[0] == "jcmd" {
+			return "com.sun.tools.attach.AttachNotSupportedException: Unable to open socket file", nil
+		}
+		return "Heap dump file created", nil
+	}
+	defer func() {
+		helpers.GetContainerMemoryUsage = originalGetContainerMemoryUsage
+		helpers.ExecInContainer = originalExecInContainer
+	}()
+
+	_, err := createMemoryDump(context.Background(), nil, "test-container", "jcmd", 1234, "/tmp/dumps/test.dmp", 1800.0, "http://localhost", time.Second, "")
+	if err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	expected := []string{
+		"jcmd 1234 GC.heap_dump /tmp/dumps/test.hprof",
+		"jmap -dump:live,format=b,file=/tmp/dumps/test.hprof 1234",
+	}
+	if !reflect.DeepEqual(commands, expected) {
+		t.Errorf("Unexpected commands: got %q, want %q", commands, expected)
+	}
+}
+
+func TestCreateMemoryDumpType(t *testing.T) {
+	var commands []string
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		commands = append(commands, strings.Join(command, " "))
+		return "", nil
+	}
+	defer func() { helpers.ExecInContainer = originalExecInContainer }()
+
+	tests := []struct {
+		tool     string
+		dumpType string
+		want     string
+	}{
+		{"procdump", dumpTypeMini, "procdump -d -n 1 -s 1 -mp -p 1234 -o /tmp/dumps/test.dmp"},
+		{"procdump", dumpTypeFull, "procdump -d -n 1 -s 1 -p 1234 -o /tmp/dumps/test.dmp"},
+		{"dotnet-dump", dumpTypeTriage, dotnetDumpPath + " collect -p 1234 -o /tmp/dumps/test.dmp --type Triage"},
+		{"dotnet-dump", "", dotnetDumpPath + " collect -p 1234 -o /tmp/dumps/test.dmp"},
+		{"dotMemory", dumpTypeHeap, dotMemoryPath + " get-snapshot 1234 --save-to-file=/tmp/dumps/test.dmp --overwrite"},
+	}
+	for _, tt := range tests {
+		commands = nil
+		if _, err := createMemoryDump(context.Background(), nil, "test-container", tt.tool, 1234, "/tmp/dumps/test.dmp", 0, "http://localhost", time.Second, tt.dumpType); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(commands) == 0 || commands[0] != tt.want {
+			t.Errorf("%s %s: unexpected commands: got %q, want %q", tt.tool, tt.dumpType, commands, tt.want)
+		}
+	}
+
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "gcore", DumpType: dumpTypeTriage, DumpsCount: 1}
+	if _, err := newContainerMonitor(monitorSettings{}, target); err == nil {
+		t.Error("Expected an error for a dump type gcore does not support")
+	}
+}
+
+func TestGcoreDetect(t *testing.T) {
+	var output string
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		return output, nil
+	}
+	defer func() { helpers.ExecInContainer = originalExecInContainer }()
+
+	target := dumpTarget{containerName: "test-container", baseDockerURL: "http://localhost"}
+	// which prints nothing when gcore is missing, and exec does not report its exit code
+	output = ""
+	if _, installed := (gcoreTool{}).Detect(target); installed {
+		t.Error("Expected gcore to be reported missing for an empty which output")
+	}
+	output = "/usr/bin/gcore\n"
+	if _, installed := (gcoreTool{}).Detect(target); !installed {
+		t.Error("Expected gcore to be reported installed")
+	}
+}
+
+func TestDumpToolVersion(t *testing.T) {
+	outputs := map[string]string{
+		"gdb":          "GNU gdb (Debian 13.1-3) 13.1\nCopyright (C) 2023 Free Software Foundation, Inc.\n",
+		"procdump":     "\nProcDump v3.3 - Sysinternals process dump utility\n",
+		dotnetDumpPath: "8.0.532401+a1b2c3\n",
+		"sh":           "openjdk version \"17.0.12\" 2024-07-16\n",
+	}
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		// The output is split across frames like a multiplexed exec stream
+		output := outputs[command[0]]
+		return execFrame(output[:len(output)/2]) + execFrame(output[len(output)/2:]), nil
+	}
+	defer func() { helpers.ExecInContainer = originalExecInContainer }()
+
+	tests := map[string]string{
+		"gcore":       "GNU gdb (Debian 13.1-3) 13.1",
+		"procdump":    "ProcDump v3.3 - Sysinternals process dump utility",
+		"dotnet-dump": "8.0.532401+a1b2c3",
+		"jcmd":        "openjdk version \"17.0.12\" 2024-07-16",
+	}
+	for name, expected := range tests {
+		tool, _ := getDumpTool(name)
+		if version := tool.Version(dumpTarget{}); version != expected {
+			t.Errorf("%s: unexpected version %q, want %q", name, version, expected)
+		}
+	}
+}
+
+func TestWaitForMemoryThresholdCanceled(t *testing.T) {
+	originalGetContainerMemoryUsage := helpers.GetContainerMemoryUsage
+	helpers.GetContainerMemoryUsage = func(client *http.Client, containerName, baseDockerURL string, getTotalMemory bool) (float64, uint64, error) {
+		return 50.0, 2000, nil
+	}
+	defer func() { helpers.GetContainerMemoryUsage = originalGetContainerMemoryUsage }()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err := waitForMemoryThreshold(dumpRequest{ctx: ctx, totalMemoryThreshold: 1800, checkInterval: time.Hour})
+	if err == nil || !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Errorf("Expected the wait to stop with the context, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Expected the wait to stop right away, took %v", elapsed)
+	}
+}
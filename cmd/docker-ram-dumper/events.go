@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// watchedEvents are the container events the monitors react to.
+var watchedEvents = []string{"start", "die", "oom", "restart"}
+
+// watchEvents forwards the Docker container events to the monitors of the
+// group, resubscribing whenever the stream breaks, until ctx is done.
+func watchEvents(ctx context.Context, settings monitorSettings, group *monitorGroup) {
+	for {
+		err := helpers.WatchContainerEvents(ctx, settings.client, settings.baseDockerURL, watchedEvents, group.route)
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Println("Docker events stream interrupted:", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(settings.checkInterval):
+		}
+	}
+}
+
+// matches reports whether the event is about the monitored container, which
+// may be configured either by name or by (short) ID.
+func (m *containerMonitor) matches(event helpers.DockerEvent) bool {
+	name := m.target.Container
+	return name == event.Actor.Attributes["name"] || (len(name) >= 12 && strings.HasPrefix(event.Actor.ID, name))
+}
+
+// handleEvent updates the monitor state for a container event and reports
+// whether the monitor was resumed by it.
+func (m *containerMonitor) handleEvent(event helpers.DockerEvent) bool {
+	switch event.Action {
+	case "die":
+		if !m.paused {
+			m.logf("Container stopped (exit code %s). Pausing monitoring until it starts again.", event.Actor.Attributes["exitCode"])
+			m.paused = true
+			m.setState("paused")
+		}
+	case "start", "restart":
+		if !m.paused {
+			return false
+		}
+		m.paused = false
+		m.logf("Container started. Resuming monitoring.")
+		// The process starts from scratch, its memory trend is no longer relevant
+		m.history.reset()
+		m.resolveThreshold()
+		if !m.settings.hostMode {
+			pid, err := helpers.GetPIDInContainer(m.settings.client, m.target.Container, m.target.Process, m.settings.baseDockerURL)
+			if err != nil {
+				m.logf("Error getting PID after restart: %v", err)
+			} else {
+				m.logf("PID of %s is %d", m.target.Process, pid)
+			}
+		}
+		return true
+	case "oom":
+		m.logf("Container was OOM-killed at %s. Last seen memory usage: %.0f MB (%.2f%%)", event.Time().Format(time.RFC3339), m.lastUsageMB, m.lastUsagePercent)
+		err := appendHistory(m.settings.dumpDirHost, historyEntry{
+			Time:               event.Time(),
+			Container:          m.target.Container,
+			Event:              "oom",
+			MemoryUsageMB:      m.lastUsageMB,
+			MemoryUsagePercent: m.lastUsagePercent,
+		})
+		if err != nil {
+			m.logf("Error recording OOM event: %v", err)
+		}
+	}
+	return false
+}
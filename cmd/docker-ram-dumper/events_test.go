@@ -0,0 +1,72 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func testEvent(action string) helpers.DockerEvent {
+	var event helpers.DockerEvent
+	event.Type = "container"
+	event.Action = action
+	event.Actor.ID = "0123456789abcdef"
+	event.Actor.Attributes = map[string]string{"name": "test-container", "exitCode": "137"}
+	event.TimeNano = time.Date(2024, 10, 1, 12, 0, 0, 0, time.UTC).UnixNano()
+	return event
+}
+
+func TestMonitorHandleEvents(t *testing.T) {
+	originalGetContainerMemoryUsage := helpers.GetContainerMemoryUsage
+	helpers.GetContainerMemoryUsage = func(client *http.Client, containerName, baseDockerURL string, getTotalMemory bool) (float64, uint64, error) {
+		return 50.0, 2000, nil
+	}
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		return "1234 root      0:00 dotnet", nil
+	}
+	defer func() {
+		helpers.GetContainerMemoryUsage = originalGetContainerMemoryUsage
+		helpers.ExecInContainer = originalExecInContainer
+	}()
+
+	dumpDir := t.TempDir()
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1}
+	m, err := newContainerMonitor(monitorSettings{dumpDirHost: dumpDir, checkInterval: time.Second}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.lastUsageMB = 1900
+	m.lastUsagePercent = 95
+
+	if !m.matches(testEvent("die")) {
+		t.Fatal("Expected the event to match the monitored container")
+	}
+
+	m.handleEvent(testEvent("die"))
+	if !m.paused {
+		t.Error("Expected the monitor to be paused after a die event")
+	}
+	if !m.handleEvent(testEvent("start")) || m.paused {
+		t.Error("Expected the monitor to resume after a start event")
+	}
+
+	m.handleEvent(testEvent("oom"))
+	data, err := os.ReadFile(filepath.Join(dumpDir, historyFileName))
+	if err != nil {
+		t.Fatalf("Failed to read history file: %v", err)
+	}
+	var entry historyEntry
+	if err := json.Unmarshal([]byte(strings.TrimSpace(string(data))), &entry); err != nil {
+		t.Fatalf("Failed to parse history entry: %v", err)
+	}
+	if entry.Event != "oom" || entry.Container != "test-container" || entry.MemoryUsageMB != 1900 || !entry.Time.Equal(testEvent("oom").Time()) {
+		t.Errorf("Unexpected history entry: %+v", entry)
+	}
+}
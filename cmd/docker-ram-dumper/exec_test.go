@@ -0,0 +1,10 @@
+package main
+
+import "encoding/binary"
+
+// execFrame frames output the way Docker multiplexes exec output on stdout.
+func execFrame(output string) string {
+	header := []byte{1, 0, 0, 0}
+	header = binary.BigEndian.AppendUint32(header, uint32(len(output)))
+	return string(header) + output
+}
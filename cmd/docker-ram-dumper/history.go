@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// historyFileName is the file in the host dump directory that records the
+// dumps and notable container events, one JSON object per line.
+const historyFileName = "dump-history.jsonl"
+
+// historyMu serializes writes of the monitors sharing the history file.
+var historyMu sync.Mutex
+
+type historyEntry struct {
+	Time               time.Time `json:"time"`
+	Container          string    `json:"container"`
+	Event              string    `json:"event"`
+	MemoryUsageMB      float64   `json:"memory_usage_mb"`
+	MemoryUsagePercent float64   `json:"memory_usage_percent"`
+	Reason             string    `json:"reason,omitempty"`
+	SeriesID           string    `json:"series_id,omitempty"`
+	SeriesIndex        int       `json:"series_index,omitempty"`
+	Files              []string  `json:"files,omitempty"`
+}
+
+// appendHistory adds an entry to the history file in dumpDir.
+func appendHistory(dumpDir string, entry historyEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %v", err)
+	}
+
+	historyMu.Lock()
+	defer historyMu.Unlock()
+	f, err := os.OpenFile(filepath.Join(dumpDir, historyFileName), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open history file: %v", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write history file: %v", err)
+	}
+	return nil
+}
+
+// readHistory returns the entries of the history file in dumpDir. The caller
+// must hold historyMu.
+func readHistory(dumpDir string) ([]historyEntry, error) {
+	data, err := os.ReadFile(filepath.Join(dumpDir, historyFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history file: %v", err)
+	}
+	var entries []historyEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		var entry historyEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, fmt.Errorf("failed to parse history file: %v", err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// hostProcRoot is the procfs of the host PID namespace. The dumper container
+// has to be started with --pid=host for host mode to see the target processes.
+var hostProcRoot = "/proc"
+
+var runHostCommand = func(name string, args ...string) (string, error) {
+	output, err := helpers.RunCommand(name, args...)
+	return string(output), err
+}
+
+// hostDumpRequest describes a dump captured from the host PID namespace.
+// The embedded request pid is the PID inside the container, hostPID is the
+// same process as seen from the host.
+type hostDumpRequest struct {
+	dumpRequest
+	hostPID int
+}
+
+// hostCapturer is implemented by dump tools that can capture a dump from the
+// dumper's own container, without exec-ing anything in the target container.
+type hostCapturer interface {
+	CaptureHost(req hostDumpRequest) (string, error)
+	// HostVersion returns the version of what writes the dump of hostPID in
+	// host mode, or an empty string when it is unknown.
+	HostVersion(hostPID int) string
+}
+
+// captureFromHost resolves processName in the container through the host
+// procfs, captures a dump of it straight into dumpDirHost and returns the
+// written files, the container PID of the process and the version of the
+// tool that wrote the dump. fileName returns the dump file name for the
+// container PID.
+func captureFromHost(ctx context.Context, client *http.Client, containerName, processName string, tool DumpTool, dumpDirHost string, fileName func(pid int) string, totalMemoryThreshold float64, baseDockerURL string, checkInterval time.Duration, dumpType string) ([]string, int, string, error) {
+	capturer, ok := tool.(hostCapturer)
+	if !ok {
+		return nil, 0, "", fmt.Errorf("%s does not support host mode", tool.Name())
+	}
+
+	initPID, err := helpers.GetContainerHostPID(client, containerName, baseDockerURL)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	hostPID, pid, err := findHostPID(hostProcRoot, initPID, processName)
+	if err != nil {
+		return nil, 0, "", err
+	}
+	fmt.Printf("PID of %s is %d (host PID %d)\n", processName, pid, hostPID)
+
+	dumpFile := filepath.Join(dumpDirHost, fileName(pid))
+	output, err := capturer.CaptureHost(hostDumpRequest{
+		dumpRequest: dumpRequest{
+			dumpTarget:           dumpTarget{client: client, containerName: containerName, baseDockerURL: baseDockerURL},
+			ctx:                  ctx,
+			pid:                  pid,
+			dumpFile:             dumpFile,
+			totalMemoryThreshold: totalMemoryThreshold,
+			checkInterval:        checkInterval,
+			dumpType:             dumpType,
+		},
+		hostPID: hostPID,
+	})
+	if err != nil {
+		return nil, pid, "", fmt.Errorf("%v. Output: %s", err, output)
+	}
+	return tool.OutputFiles(dumpFile, hostPID), pid, capturer.HostVersion(hostPID), nil
+}
+
+// findHostPID looks for processName among the processes sharing the PID
+// namespace of the container init process initPID. It returns the host PID
+// and the PID inside the container of the most recently started match.
+func findHostPID(procRoot string, initPID int, processName string) (int, int, error) {
+	containerNS, err := os.Readlink(filepath.Join(procRoot, strconv.Itoa(initPID), "ns", "pid"))
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to read PID namespace of container init process %d: %v", initPID, err)
+	}
+
+	entries, err := os.ReadDir(procRoot)
+	if err != nil {
+		return 0, 0, fmt.Errorf("failed to list processes: %v", err)
+	}
+	var candidates []int
+	for _, entry := range entries {
+		hostPID, err := strconv.Atoi(entry.Name())
+		if err != nil {
+			continue
+		}
+		ns, err := os.Readlink(filepath.Join(procRoot, entry.Name(), "ns", "pid"))
+		if err != nil || ns != containerNS {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join(procRoot, entry.Name(), "cmdline"))
+		if err != nil || !strings.Contains(strings.ReplaceAll(string(cmdline), "\x00", " "), processName) {
+			continue
+		}
+		candidates = append(candidates, hostPID)
+	}
+	if len(candidates) == 0 {
+		return 0, 0, fmt.Errorf("no process found with name: %s in the PID namespace of %d", processName, initPID)
+	}
+	sort.Ints(candidates)
+	hostPID := candidates[len(candidates)-1]
+
+	pid, err := namespacePID(procRoot, hostPID)
+	if err != nil {
+		return 0, 0, err
+	}
+	return hostPID, pid, nil
+}
+
+// namespacePID returns the PID of hostPID in its innermost PID namespace,
+// taken from the NSpid line of /proc/<pid>/status.
+func namespacePID(procRoot string, hostPID int) (int, error) {
+	status, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(hostPID), "status"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to read status of process %d: %v", hostPID, err)
+	}
+	for _, line := range strings.Split(string(status), "\n") {
+		if !strings.HasPrefix(line, "NSpid:") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, "NSpid:"))
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.Atoi(fields[len(fields)-1])
+	}
+	return 0, fmt.Errorf("no NSpid found for process %d", hostPID)
+}
+
+// moveFile moves src to dst, copying the data when they are on different
+// filesystems, as it is the case for files under /proc/<pid>/root.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", src, err)
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", dst, err)
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return fmt.Errorf("failed to copy %s to %s: %v", src, dst, err)
+	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", dst, err)
+	}
+	return os.Remove(src)
+}
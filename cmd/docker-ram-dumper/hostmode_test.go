@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// fakeProcess creates a /proc/<pid> entry with the files findHostPID reads.
+func fakeProcess(t *testing.T, procRoot string, hostPID int, pidNS, cmdline string, nsPID int) {
+	dir := filepath.Join(procRoot, strconv.Itoa(hostPID))
+	if err := os.MkdirAll(filepath.Join(dir, "ns"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(pidNS, filepath.Join(dir, "ns", "pid")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cmdline"), []byte(cmdline), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	status := "Name:\ttest\nNSpid:\t" + strconv.Itoa(hostPID) + "\t" + strconv.Itoa(nsPID) + "\n"
+	if err := os.WriteFile(filepath.Join(dir, "status"), []byte(status), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindHostPID(t *testing.T) {
+	procRoot := t.TempDir()
+	fakeProcess(t, procRoot, 100, "pid:[4026531836]", "/sbin/init\x00", 1)
+	fakeProcess(t, procRoot, 200, "pid:[4026532000]", "/bin/sh\x00", 1)
+	fakeProcess(t, procRoot, 210, "pid:[4026532000]", "dotnet\x00nethermind.dll\x00", 7)
+	fakeProcess(t, procRoot, 300, "pid:[4026532111]", "dotnet\x00other.dll\x00", 7)
+
+	hostPID, pid, err := findHostPID(procRoot, 200, "nethermind")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if hostPID != 210 || pid != 7 {
+		t.Errorf("Unexpected PIDs: got host %d / container %d, want 210 / 7", hostPID, pid)
+	}
+
+	if _, _, err := findHostPID(procRoot, 200, "other.dll"); err == nil {
+		t.Error("Expected an error for a process in another PID namespace")
+	}
+}
+
+func TestFindCreatedump(t *testing.T) {
+	procRoot := t.TempDir()
+	dir := filepath.Join(procRoot, "42")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	maps := "7f00-7f01 r-xp 00000000 08:01 1234 /usr/share/dotnet/shared/Microsoft.NETCore.App/8.0.8/libcoreclr.so\n"
+	if err := os.WriteFile(filepath.Join(dir, "maps"), []byte(maps), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	createdump, err := findCreatedump(procRoot, 42)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "/usr/share/dotnet/shared/Microsoft.NETCore.App/8.0.8/createdump"
+	if createdump != expected {
+		t.Errorf("Unexpected createdump path: got %q, want %q", createdump, expected)
+	}
+}
+
+func TestContainerTmpDir(t *testing.T) {
+	procRoot := t.TempDir()
+	if _, err := containerTmpDir(procRoot, 42); err == nil || !strings.Contains(err.Error(), "has no /tmp") {
+		t.Errorf("Expected an error for a container without /tmp, got %v", err)
+	}
+
+	tmp := filepath.Join(procRoot, "42", "root", "tmp")
+	if err := os.MkdirAll(tmp, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	dir, err := containerTmpDir(procRoot, 42)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if dir != tmp {
+		t.Errorf("Unexpected directory: got %q, want %q", dir, tmp)
+	}
+	if entries, _ := os.ReadDir(tmp); len(entries) != 0 {
+		t.Errorf("Expected the write check to leave /tmp of the container untouched, got %d files", len(entries))
+	}
+}
+
+func TestDotnetDumpHostVersion(t *testing.T) {
+	procRoot := t.TempDir()
+	originalHostProcRoot := hostProcRoot
+	hostProcRoot = procRoot
+	defer func() { hostProcRoot = originalHostProcRoot }()
+
+	dir := filepath.Join(procRoot, "42")
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	maps := "7f00-7f01 r-xp 00000000 08:01 1234 /usr/share/dotnet/shared/Microsoft.NETCore.App/8.0.8/libcoreclr.so\n"
+	if err := os.WriteFile(filepath.Join(dir, "maps"), []byte(maps), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	if version := (dotnetDumpTool{}).HostVersion(42); version != ".NET runtime 8.0.8" {
+		t.Errorf("Unexpected version: %q", version)
+	}
+	if version := (dotnetDumpTool{}).HostVersion(43); version != "" {
+		t.Errorf("Expected no version for an unknown process, got %q", version)
+	}
+}
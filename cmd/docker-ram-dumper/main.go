@@ -2,16 +2,12 @@ package main
 
 import (
 	"context"
-	"errors"
 	"flag"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
-	"os/exec"
-	"path/filepath"
-	"runtime"
-	"strconv"
+	"slices"
 	"strings"
 	"time"
 
@@ -26,43 +22,195 @@ var (
 func main() {
 	var (
 		threshold        string
-		thresholdValue   float64
-		isPercentage     bool
 		processName      string
 		dumpDirContainer string
 		dumpDirHost      string
 		containerName    string
+		configFile       string
+		labelSelector    string
 		checkInterval    time.Duration
 		monitor          bool
 		dumpsCount       int
 		cleanup          bool
 		baseDockerURL    string
 		dumpTool         string
+		dumpType         string
 		globalTimeout    time.Duration
 		installOnly      bool
+		hostMode         bool
+		memoryMetric     string
+		processMemory    string
+		growth           string
+		oomHorizon       string
+		forecastWindow   time.Duration
+		seriesStep       string
+		seriesInterval   string
+		cooldown         string
+		rearm            string
+		cgroupRoot       string
+		psiSome          float64
+		psiFull          float64
+		memoryEvents     string
+		runtimeCounters  string
+		minFreeSpace     string
+		keepLast         int
+		maxAge           time.Duration
+		maxTotalSize     string
+		compress         string
+		compressLevel    int
+		copyChunkSize    string
+		copyRetries      int
+		s3               s3Config
+		s3PartSize       string
+		sinkSpecs        listFlag
+		sinkOpts         sinkOptions
+		httpSinkHeaders  listFlag
+		deleteLocal      bool
 	)
 
 	flag.StringVar(&threshold, "threshold", "90%", "Memory usage threshold (e.g., '90%' or '1000MB')")
 	flag.StringVar(&processName, "process", "dotnet", "Name of the process to monitor")
 	flag.StringVar(&dumpDirContainer, "dumpdir-container", "/tmp/dumps", "Directory to store memory dumps inside the container")
 	flag.StringVar(&dumpDirHost, "dumpdir-host", "/tmp/dumps", "Directory to store memory dumps on the host")
-	flag.StringVar(&containerName, "container", "sedge-node", "Name of the container to monitor")
+	flag.StringVar(&containerName, "container", "sedge-node", "Name of the container to monitor, or a comma separated list of containers")
+	flag.StringVar(&configFile, "config", "", "JSON file with the list of containers to monitor and their settings (overrides -container)")
+	flag.StringVar(&labelSelector, "label", "", "Monitor all containers with these labels (e.g. 'ram-dumper.enabled=true'), overrides -container and -config")
 	flag.DurationVar(&checkInterval, "interval", 30*time.Second, "Interval between memory checks")
 	flag.BoolVar(&monitor, "monitor", false, "Continuously monitor memory usage")
 	flag.IntVar(&dumpsCount, "dumps-count", 1, "Number of memory dumps to create before stopping")
 	flag.BoolVar(&cleanup, "cleanup", false, "Clean up dumps in container after a memory dump")
 	flag.StringVar(&baseDockerURL, "docker-url", "http://localhost", "Base URL for Docker API")
-	flag.StringVar(&dumpTool, "dump-tool", "procdump", "Tool to use for memory dump (procdump, dotnet-dump, dotMemory)")
+	flag.StringVar(&dumpTool, "dump-tool", "procdump", "Tool to use for memory dump ("+strings.Join(dumpToolNames(), ", ")+")")
+	flag.StringVar(&dumpType, "dump-type", "", "Type of dump ("+strings.Join(dumpTypes, ", ")+"), defaults to the dump tool default")
 	flag.DurationVar(&globalTimeout, "timeout", 0, "Global timeout for the application (e.g., 1h, 30m, 1h30m)")
 	flag.StringVar(&dotMemoryTimeout, "dotmemory-timeout", "30s", "Timeout for dotMemory tool")
 	flag.StringVar(&dotMemoryVersion, "dotmemory-version", "2024.3.5", "Version of dotMemory tool")
 	flag.BoolVar(&installOnly, "install", false, "Install dump tool and exit")
+	flag.BoolVar(&hostMode, "host-mode", false, "Capture dumps from the host PID namespace without installing anything in the target container (requires --pid=host)")
+	flag.StringVar(&memoryMetric, "memory-metric", helpers.MemoryMetricWorkingSet, "Memory metric compared against the threshold ("+strings.Join(helpers.MemoryMetrics, ", ")+")")
+	flag.StringVar(&processMemory, "process-memory", "", "Compare the memory of the monitored process instead of the whole container against the threshold ("+strings.Join(processMemoryMetrics(), ", ")+")")
+	flag.StringVar(&growth, "growth", "", "Also dump when memory grows steadily by this much over a period (e.g. '200MB/15m')")
+	flag.StringVar(&oomHorizon, "oom-horizon", "", "Also dump when the memory limit is forecast to be reached within this time (e.g. '10m')")
+	flag.DurationVar(&forecastWindow, "forecast-window", 10*time.Minute, "Period of memory samples used to forecast the time to OOM")
+	flag.StringVar(&seriesStep, "series-step", "", "Take the dumps after the first one as a series, each time memory grows by this much over the first dump (e.g. '500MB')")
+	flag.StringVar(&seriesInterval, "series-interval", "", "Take the dumps after the first one as a series, at this time offset from each other (e.g. '10m')")
+	flag.StringVar(&cooldown, "cooldown", "", "Minimum time between two dumps of the same container (e.g. '30m')")
+	flag.StringVar(&rearm, "rearm", "", "After a dump, memory usage must drop below this watermark before another dump (e.g. '80%' or '3000MB')")
+	flag.StringVar(&cgroupRoot, "cgroup-root", "/sys/fs/cgroup", "Host cgroup v2 root, used by the -psi-some, -psi-full and -memory-events triggers")
+	flag.Float64Var(&psiSome, "psi-some", 0, "Also dump when the memory pressure 'some' avg10 of the container reaches this percentage")
+	flag.Float64Var(&psiFull, "psi-full", 0, "Also dump when the memory pressure 'full' avg10 of the container reaches this percentage")
+	flag.StringVar(&memoryEvents, "memory-events", "", "Also dump when one of these memory.events counters of the container increases (e.g. 'high,max,oom')")
+	flag.StringVar(&runtimeCounters, "runtime-counters", "", "Also dump when a .NET runtime counter of the process exceeds a size, for dotnet-dump and dotMemory (e.g. 'gc-heap-size > 6GB', counters: "+strings.Join(runtimeCounterNames(), ", ")+")")
+	flag.StringVar(&minFreeSpace, "min-free-space", "1GB", "Space that must stay free in the container and host dump directories after a dump, smaller dump types are used or the dump is skipped otherwise")
+	flag.IntVar(&keepLast, "keep-last", 0, "Number of most recent dumps kept per container in the host dump directory, 0 keeps all")
+	flag.DurationVar(&maxAge, "max-age", 0, "Delete dumps older than this from the host dump directory (e.g. '168h')")
+	flag.StringVar(&maxTotalSize, "max-total-size", "", "Total size of the dumps kept in the host dump directory, the oldest are deleted first (e.g. '50GB')")
+	flag.StringVar(&compress, "compress", helpers.CompressionNone, "Compress dumps while copying them to the host ("+strings.Join(helpers.Compressions, ", ")+")")
+	flag.IntVar(&compressLevel, "compress-level", 0, "Compression level, 1-9 for gzip and 1-22 for zstd (default: the algorithm default)")
+	flag.StringVar(&copyChunkSize, "copy-chunk-size", "256MB", "Dumps are copied from the container in chunks of this size, each checked against its checksum and retried on failure")
+	flag.IntVar(&copyRetries, "copy-retries", 3, "Number of times a chunk that failed to copy is retried, resuming from the last good chunk")
+	flag.StringVar(&s3.endpoint, "s3-endpoint", "", "S3-compatible endpoint dumps are uploaded to (default: AWS S3 in -s3-region)")
+	flag.StringVar(&s3.region, "s3-region", "us-east-1", "S3 region")
+	flag.StringVar(&s3.bucket, "s3-bucket", "", "Upload dumps and their manifests to this S3 bucket after saving them to the host")
+	flag.StringVar(&s3.prefix, "s3-prefix", "", "Key prefix of the uploaded dumps, followed by <host>/<container>/<file>")
+	flag.StringVar(&s3.accessKey, "s3-access-key", os.Getenv("AWS_ACCESS_KEY_ID"), "S3 access key (default: $AWS_ACCESS_KEY_ID)")
+	flag.StringVar(&s3.secretKey, "s3-secret-key", os.Getenv("AWS_SECRET_ACCESS_KEY"), "S3 secret key (default: $AWS_SECRET_ACCESS_KEY)")
+	flag.BoolVar(&s3.pathStyle, "s3-path-style", false, "Use path-style S3 URLs, as MinIO expects")
+	flag.StringVar(&s3PartSize, "s3-part-size", "64MB", "Part size of multipart uploads, larger files are uploaded in parts")
+	flag.Var(&sinkSpecs, "sink", "Also store dumps and their manifests in this directory, sftp://user@host/dir or http(s):// URL, can be repeated")
+	flag.StringVar(&sinkOpts.sftpKey, "sftp-key", "", "Private key file used to authenticate to SFTP sinks")
+	flag.StringVar(&sinkOpts.sftpKnownHosts, "sftp-known-hosts", defaultKnownHosts(), "known_hosts file used to verify the host key of SFTP sinks")
+	flag.BoolVar(&sinkOpts.sftpInsecure, "sftp-insecure", false, "Do not verify the host key of SFTP sinks")
+	flag.StringVar(&sinkOpts.httpMethod, "http-sink-method", "PUT", "Method of HTTP sinks, PUT sends each file to <url>/<host>/<container>/<file>, POST sends them all to the URL")
+	flag.Var(&httpSinkHeaders, "http-sink-header", "Header added to the requests of HTTP sinks (e.g. 'Authorization: Bearer <token>'), can be repeated")
+	flag.BoolVar(&deleteLocal, "delete-local", false, "Delete the local dump and manifest once every sink stored them")
+	flag.BoolVar(&deleteLocal, "s3-delete-local", false, "Same as -delete-local")
 	flag.Parse()
 
-	isPercentage = !strings.HasSuffix(strings.ToLower(threshold), "mb")
-	thresholdStr := strings.TrimSuffix(strings.ToLower(threshold), "%")
-	thresholdStr = strings.TrimSuffix(thresholdStr, "mb")
-	thresholdValue, _ = strconv.ParseFloat(thresholdStr, 64)
+	if !slices.Contains(helpers.MemoryMetrics, memoryMetric) {
+		fmt.Printf("Unsupported memory metric: %s (supported: %s)\n", memoryMetric, strings.Join(helpers.MemoryMetrics, ", "))
+		os.Exit(1)
+	}
+	helpers.MemoryMetric = memoryMetric
+	minFreeSpaceMB, err := parseSizeMB(minFreeSpace)
+	if err != nil {
+		fmt.Printf("Invalid -min-free-space: %v\n", err)
+		os.Exit(1)
+	}
+	compression := helpers.Compression{Algorithm: compress, Level: compressLevel}
+	if err := compression.Validate(); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	if hostMode && compress != helpers.CompressionNone {
+		fmt.Println("-compress is not supported with -host-mode, dumps are written to the host directly")
+		os.Exit(1)
+	}
+	copyChunkSizeMB, err := parseSizeMB(copyChunkSize)
+	if err != nil || copyChunkSizeMB < 1 {
+		fmt.Printf("Invalid -copy-chunk-size %q, expected at least 1MB\n", copyChunkSize)
+		os.Exit(1)
+	}
+	sinkOpts.httpHeaders = httpSinkHeaders
+	var sinks []Sink
+	for _, spec := range sinkSpecs {
+		sink, err := newSink(spec, sinkOpts)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		sinks = append(sinks, sink)
+	}
+	if s3.bucket != "" {
+		partSizeMB, err := parseSizeMB(s3PartSize)
+		if err != nil {
+			fmt.Printf("Invalid -s3-part-size: %v\n", err)
+			os.Exit(1)
+		}
+		s3.partSize = int64(partSizeMB * 1024 * 1024)
+		s3.sessionToken = os.Getenv("AWS_SESSION_TOKEN")
+		uploader, err := newS3Uploader(s3)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		sinks = append(sinks, uploader)
+	}
+	retention := retentionPolicy{keepLast: keepLast, maxAge: maxAge}
+	if maxTotalSize != "" {
+		retention.maxTotalMB, err = parseSizeMB(maxTotalSize)
+		if err != nil {
+			fmt.Printf("Invalid -max-total-size: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	defaults := targetConfig{
+		Threshold:  threshold,
+		Process:    processName,
+		DumpTool:   dumpTool,
+		DumpType:   dumpType,
+		DumpsCount: dumpsCount,
+		Growth:     growth,
+		OOMHorizon: oomHorizon,
+
+		SeriesStep:     seriesStep,
+		SeriesInterval: seriesInterval,
+
+		Cooldown: cooldown,
+		Rearm:    rearm,
+
+		RuntimeCounters: runtimeCounters,
+	}
+	targets := targetsFromFlags(containerName, defaults)
+	if configFile != "" {
+		var err error
+		targets, err = loadTargetsFile(configFile, defaults)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
 
 	// Create a Unix socket HTTP client
 	client := &http.Client{
@@ -76,39 +224,69 @@ func main() {
 
 	// If install-only mode is enabled, install the tool and exit
 	if installOnly {
-		fmt.Printf("Installing %s dump tool...\n", dumpTool)
-		output, err := installDumpTool(client, containerName, dumpTool, baseDockerURL)
-		if err != nil {
-			fmt.Printf("Failed to install %s: %v\n", dumpTool, err)
-			os.Exit(1)
+		if labelSelector != "" {
+			// Install the tool in the containers discovery would monitor
+			discovered := newDiscovery(monitorSettings{client: client, baseDockerURL: baseDockerURL}, labelSelector, defaults, nil)
+			targets, err = discovered.newTargets()
+			if err != nil {
+				fmt.Println("Error discovering containers:", err)
+				os.Exit(1)
+			}
+		}
+		for _, target := range targets {
+			fmt.Printf("Installing %s dump tool in %s...\n", target.DumpTool, target.Container)
+			output, err := installDumpTool(client, target.Container, target.DumpTool, baseDockerURL)
+			if err != nil {
+				fmt.Printf("Failed to install %s: %v\n", target.DumpTool, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Successfully installed %s\nOutput: \n\n%s\n", target.DumpTool, output)
 		}
-		fmt.Printf("Successfully installed %s\nOutput: \n\n%s\n", dumpTool, output)
 		os.Exit(0)
 	}
 
-	if cleanup {
-		defer cleanupDumps(client, containerName, dumpDirContainer, baseDockerURL)
-		defer killProcess(client, containerName, dumpTool, baseDockerURL)
+	settings := monitorSettings{
+		client:           client,
+		baseDockerURL:    baseDockerURL,
+		dumpDirContainer: dumpDirContainer,
+		dumpDirHost:      dumpDirHost,
+		checkInterval:    checkInterval,
+		monitor:          monitor,
+		cleanup:          cleanup,
+		hostMode:         hostMode,
+		processMemory:    processMemory,
+		forecastWindow:   forecastWindow,
+		cgroupRoot:       cgroupRoot,
+		psiSome:          psiSome,
+		psiFull:          psiFull,
+		memoryEvents:     splitList(memoryEvents),
+		minFreeSpaceMB:   minFreeSpaceMB,
+		retention:        retention,
+		compression:      compression,
+		copyChunkSize:    int64(copyChunkSizeMB * 1024 * 1024),
+		copyRetries:      copyRetries,
+		sinks:            sinks,
+		deleteStored:     deleteLocal,
+	}
+	var monitors []*containerMonitor
+	if labelSelector == "" {
+		for _, target := range targets {
+			m, err := newContainerMonitor(settings, target)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			monitors = append(monitors, m)
+		}
 	}
 
 	// Ensure dump directory exists
-	err := os.MkdirAll(dumpDirHost, 0o755)
+	err = os.MkdirAll(dumpDirHost, 0o755)
 	if err != nil {
 		fmt.Println("Error creating dump directory:", err)
 		return
 	}
 
-	dumpCounter := 0
-	_, totalMemory, _ := helpers.GetContainerMemoryUsage(client, containerName, baseDockerURL, true)
-	var totalMemoryThreshold float64
-	if isPercentage {
-		totalMemoryThreshold = float64(totalMemory) * thresholdValue / 100
-	} else {
-		totalMemoryThreshold = thresholdValue
-		thresholdValue = thresholdValue / float64(totalMemory) * 100
-	}
-	fmt.Printf("Total memory threshold: %.0f%% (%.0f MB)\n", thresholdValue, totalMemoryThreshold)
-
 	if monitor && globalTimeout == 0 {
 		fmt.Println("Global timeout is not set. Setting it to 10 minutes. Use -timeout flag to set a different timeout.")
 		globalTimeout = 10 * time.Minute
@@ -122,105 +300,24 @@ func main() {
 		defer cancel()
 	}
 
-	for {
-		select {
-		case <-ctx.Done():
-			fmt.Printf("Global timeout: %v has been reached. Use -timeout flag to increase the timeout. Exiting the loop... \n", globalTimeout)
-			fmt.Println("Goodbye!")
-			return
-		default:
-			// Get memory usage
-			memUsagePercent, _, err := helpers.GetContainerMemoryUsage(client, containerName, baseDockerURL, false)
-			if err != nil {
-				fmt.Println("Error getting memory usage:", err)
-				if !monitor {
-					fmt.Println("'-monitor' flag is set to false. Stopping.")
-					return
-				}
-				time.Sleep(checkInterval)
-				continue
-			}
-
-			fmt.Printf("Memory usage is %.2f%%\n", memUsagePercent)
-
-			if memUsagePercent >= thresholdValue {
-				fmt.Println("Memory usage threshold exceeded. Initiating memory dump...")
-
-				// Install dependencies inside the target container
-				_, err := installDumpTool(client, containerName, dumpTool, baseDockerURL)
-				if err != nil {
-					fmt.Println("Error installing dump tool:", err)
-					time.Sleep(checkInterval)
-					return
-				}
-
-				// Get the PID of the processName process inside the target container
-				pid, err := helpers.GetPIDInContainer(client, containerName, processName, baseDockerURL)
-				if err != nil {
-					fmt.Println("Error getting PID:", err)
-					fmt.Println("Please check if the processName is correct and if the container is running.")
-					return
-				} else {
-					fmt.Printf("PID of %s is %d\n", processName, pid)
-				}
-
-				// Create a dump directory inside the container
-				_, err = helpers.ExecInContainer(client, containerName, baseDockerURL, "mkdir", "-p", "/tmp/dumps")
-				if err != nil {
-					fmt.Println("Error creating dump directory in container:", err)
-					time.Sleep(checkInterval)
-					return
-				}
-
-				// Run the selected dump tool inside the target container
-				dumpFile := fmt.Sprintf("%s/core_%d_%d.dmp", dumpDirContainer, pid, time.Now().Unix())
-				dumpOutput, err := createMemoryDump(client, containerName, dumpTool, pid, dumpFile, totalMemoryThreshold, baseDockerURL, checkInterval)
-				if err != nil {
-					fmt.Println("Error creating dump:", err)
-					fmt.Printf("Command output: %s\n", dumpOutput)
-					time.Sleep(checkInterval)
-					continue
-				}
-
-				if dumpTool == "procdump" {
-					dumpFile = dumpFile + "_0." + strconv.Itoa(pid)
-				}
-				if dumpTool == "dotMemory" {
-					// replace ".dmp" with ".dmw"
-					dumpFile = dumpFile + ".dmw"
-				}
-				// Copy the dump file from the target container to the host
-				hostDumpFile := filepath.Join(dumpDirHost, filepath.Base(dumpFile))
-				fmt.Printf("Trying to save memory dump to %s inside the target container ...\n", hostDumpFile)
-				// _ = helpers.CopyFromContainer(client, containerName, dumpFile, dumpFile, baseDockerURL)
-
-				cmd := exec.Command("docker", "cp", fmt.Sprintf("%s:%s", containerName, dumpFile), dumpFile)
-				output, err := cmd.CombinedOutput()
-				if err != nil {
-					fmt.Println("Error copying dump file (dumpFile) to host:", err)
-					fmt.Printf("Command output: %s\n", output)
-				} else {
-					fmt.Printf("Dump file copied to container: %s. Use docker volumes to get it\n", dumpFile)
-				}
-
-				dumpCounter++
-				if dumpCounter >= dumpsCount {
-					fmt.Printf("Reached the limit of %d dumps. Stopping.\n", dumpsCount)
-					return
-				}
-			} else {
-				fmt.Printf("Memory usage (%.2f%%) is below the threshold (%.2f%%).\n", memUsagePercent, thresholdValue)
-				if !monitor {
-					fmt.Println("'-monitor' flag is set to false. Dumping only once. Stopping.")
-					return
-				}
-				fmt.Println("Waiting for memory usage to exceed the threshold...")
-				fmt.Println("___")
-			}
+	// Monitor every container concurrently, sharing the Docker client
+	group := &monitorGroup{}
+	go watchEvents(ctx, settings, group)
+	if labelSelector != "" {
+		newDiscovery(settings, labelSelector, defaults, group).run(ctx)
+	}
+	for _, m := range monitors {
+		group.start(ctx, m)
+	}
+	monitors = group.wait()
 
-			time.Sleep(checkInterval)
-		}
+	if ctx.Err() != nil {
+		fmt.Printf("Global timeout: %v has been reached. Use -timeout flag to increase the timeout. Exiting the loop... \n", globalTimeout)
+	}
+	for _, m := range monitors {
+		m.logf("Final state: %s, %d of %d dumps created", m.state, m.dumpCounter, m.target.DumpsCount)
 	}
+	fmt.Println("Goodbye!")
 }
 
 func cleanupDumps(client *http.Client, containerName, dumpDirContainer, baseDockerURL string) error {
@@ -232,144 +329,3 @@ func cleanupDumps(client *http.Client, containerName, dumpDirContainer, baseDock
 	}
 	return nil
 }
-
-func killProcess(client *http.Client, containerName, processName, baseDockerURL string) error {
-	processes, _ := helpers.ExecInContainer(client, containerName, baseDockerURL, "ps", "aux")
-	fmt.Println("Active processes:\n", processes)
-	_, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "pkill", "-f", processName)
-	if err != nil {
-		return fmt.Errorf("error killing process: %v", err)
-	} else {
-		fmt.Println("Successfully killed " + processName + " process.")
-	}
-	return nil
-}
-
-func installDumpTool(client *http.Client, containerName, dumpTool, baseDockerURL string) (string, error) {
-	switch dumpTool {
-	case "procdump":
-		// Check if procdump is already installed
-		which, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "which", "procdump")
-		if err != nil {
-			fmt.Println("Procdump not found. Installing...")
-			result, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "sh", "-c", "apk add --no-cache procdump || apt-get update && apt-get install -y procdump")
-			if err != nil {
-				return "", fmt.Errorf("error installing procdump: %v", err)
-			}
-			fmt.Println("Procdump installed successfully.")
-			return result, nil
-		} else {
-			fmt.Printf("Procdump is already installed: %s\n", which)
-			return which, nil
-		}
-	case "dotnet-dump":
-		// Check if dotnet-dump is already installed
-		which, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "ls", "/root/.dotnet/tools/dotnet-dump")
-		if err != nil || strings.Contains(which, "No such file or directory") {
-			fmt.Println("dotnet-dump not found. Installing...")
-			result, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "sh", "-c", "apt-get update && apt-get install -y dotnet-sdk-8.0 curl && curl -sSL https://dot.net/v1/dotnet-install.sh -o dotnet-install.sh && chmod +x dotnet-install.sh && ./dotnet-install.sh --channel 8.0 --install-dir /root/.dotnet && dotnet tool install --global dotnet-dump")
-			if err != nil {
-				return "", fmt.Errorf("error installing dotnet-dump: %v", err)
-			}
-			fmt.Println("dotnet-dump installed successfully.")
-			return result, nil
-		} else {
-			fmt.Printf("dotnet-dump is already installed: %s\n", which)
-			return which, nil
-		}
-	case "dotMemory":
-		// Check if dotnet-dump is already installed
-		which, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "ls", "/dotMemoryclt/dotmemory")
-		if err != nil || strings.Contains(which, "No such file or directory") {
-			fmt.Println("dotMemory not found. Installing...")
-			dockerArch := "linux-arm64"
-			if runtime.GOARCH == "amd64" {
-				dockerArch = "linux-x64"
-			} else if runtime.GOARCH == "arm64" {
-				dockerArch = "linux-arm64"
-			}
-			result, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "sh", "-c", "apt-get update && apt-get install -y curl && curl -L -o dotMemory.tar.gz https://download.jetbrains.com/resharper/dotUltimate."+dotMemoryVersion+"/JetBrains.dotMemory.Console."+dockerArch+"."+dotMemoryVersion+".tar.gz && mkdir -p /dotMemoryclt && tar -xzf dotMemory.tar.gz -C /dotMemoryclt && chmod +x -R /dotMemoryclt/*")
-			if err != nil {
-				return "", fmt.Errorf("error installing dotnet-dump: %v", err)
-			}
-			fmt.Println("dotMemory installed successfully.")
-			return result, nil
-		} else {
-			fmt.Printf("dotMemory is already installed: %s\n", which)
-			return which, nil
-		}
-	default:
-		return "", fmt.Errorf("unsupported dump tool: %s", dumpTool)
-	}
-}
-
-func createMemoryDump(client *http.Client, containerName, dumpTool string, pid int, dumpFile string, totalMemoryThreshold float64, baseDockerURL string, checkInterval time.Duration) (string, error) {
-	var cmd []string
-	switch dumpTool {
-	case "procdump":
-		cmd = []string{"procdump", "-d", "-n", "1", "-s", "1", "-M", fmt.Sprintf("%.0f", totalMemoryThreshold), "-p", fmt.Sprintf("%d", pid), "-o", dumpFile}
-		return helpers.ExecInContainer(client, containerName, baseDockerURL, cmd...)
-	case "dotnet-dump":
-		// Create a wrapper function to check memory usage before running dotnet-dump
-		return createDotnetDump(client, containerName, pid, dumpFile, totalMemoryThreshold, baseDockerURL, checkInterval, "dotnet-dump")
-	case "dotMemory":
-		// Create a wrapper function to check memory usage before running dotnet-dump
-		return createDotnetDump(client, containerName, pid, dumpFile, totalMemoryThreshold, baseDockerURL, checkInterval, "dotMemory")
-	default:
-		return "", errors.New("unsupported dump tool")
-	}
-}
-
-func createDotnetDump(client *http.Client, containerName string, pid int, dumpFile string, totalMemoryThreshold float64, baseDockerURL string, checkInterval time.Duration, tool string) (string, error) {
-	for {
-		memUsagePercent, memoryUsageMB, err := helpers.GetContainerMemoryUsage(client, containerName, baseDockerURL, false)
-		if err != nil {
-			return "", fmt.Errorf("failed to get memory usage: %v", err)
-		}
-
-		if float64(memoryUsageMB) >= totalMemoryThreshold {
-			if tool == "dotnet-dump" {
-				cmd := []string{"/root/.dotnet/tools/dotnet-dump", "collect", "-p", fmt.Sprintf("%d", pid), "-o", dumpFile}
-				return helpers.ExecInContainer(client, containerName, baseDockerURL, cmd...)
-			} else if tool == "dotMemory" {
-				cmd := []string{"/dotMemoryclt/dotmemory", "attach", fmt.Sprintf("%d", pid), "--save-to-file=" + dumpFile, "--overwrite", "--trigger-on-activation", "--timeout=" + dotMemoryTimeout}
-				fmt.Println("Executing command:", cmd)
-				output, err := helpers.ExecInContainer(client, containerName, baseDockerURL, cmd...)
-				// if unrecognized address, try to run dotmemory again
-				const maxRetries = 5
-				retryCount := 0
-				for (strings.Contains(output, "unrecognized address") || strings.Contains(output, "Object reference not set to an instance of an object") || strings.Contains(output, "Non-writeable path")) && retryCount < maxRetries {
-					fmt.Printf("Retrying command (attempt %d of %d)...\n", retryCount+1, maxRetries)
-					if strings.Contains(output, "-writeable path") {
-						// remove dump directory
-						fmt.Println("Removing dump directory...")
-						helpers.ExecInContainer(client, containerName, baseDockerURL, "rm", "-rf", "/tmp/dumps")
-						time.Sleep(2 * time.Second)
-					}
-					// cmd = []string{"/dotMemoryclt/dotmemory", "get-snapshot", fmt.Sprintf("%d", pid), "--save-to-file=" + dumpFile, "--overwrite"}
-					cmd = []string{"/dotMemoryclt/dotmemory", "attach", fmt.Sprintf("%d", pid), "--save-to-file=" + dumpFile, "--overwrite", "--trigger-on-activation", "--timeout=" + dotMemoryTimeout}
-					output, err = helpers.ExecInContainer(client, containerName, baseDockerURL, cmd...)
-					retryCount++
-					if err != nil {
-						fmt.Printf("Cannot save memory dump. Attempt %d failed: %v\n", retryCount, err)
-					}
-					time.Sleep(2 * time.Second) // Add small delay between retries
-				}
-				fmt.Println("dotMemory output:", output)
-				files, _ := helpers.ExecInContainer(client, containerName, baseDockerURL, "ls", "-l", "/tmp/dumps")
-				fmt.Println("Files in /tmp/dumps:", files)
-				return output, err
-			} else {
-				return "", errors.New("unsupported dump tool: " + tool)
-			}
-		} else {
-			fmt.Printf("Memory usage is %.2f%% (%.0f MB). Waiting for memory usage to exceed %.0f%% (%.0f MB)...\n",
-				memUsagePercent,
-				float64(memoryUsageMB),
-				totalMemoryThreshold,
-				totalMemoryThreshold)
-		}
-
-		time.Sleep(checkInterval)
-	}
-}
@@ -1,16 +1,23 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
 
 	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+	"github.com/klauspost/compress/zstd"
 )
 
 var testBodyOutput []byte
@@ -89,6 +96,61 @@ func TestGetContainerMemoryUsage(t *testing.T) {
 	}
 }
 
+func TestDockerStatsMemoryValue(t *testing.T) {
+	cgroupV1 := `{"memory_stats": {"usage": 1000, "limit": 4000, "stats": {"total_inactive_file": 300, "total_rss": 500, "total_cache": 400}}}`
+	cgroupV2 := `{"memory_stats": {"usage": 1000, "limit": 4000, "stats": {"inactive_file": 200, "anon": 600, "file": 350}}}`
+	tests := []struct {
+		name   string
+		stats  string
+		metric string
+		want   uint64
+	}{
+		{"v1 usage", cgroupV1, helpers.MemoryMetricUsage, 1000},
+		{"v1 working set", cgroupV1, helpers.MemoryMetricWorkingSet, 700},
+		{"v1 anon", cgroupV1, helpers.MemoryMetricAnon, 500},
+		{"v1 rss", cgroupV1, helpers.MemoryMetricRSS, 500},
+		{"v2 usage", cgroupV2, helpers.MemoryMetricUsage, 1000},
+		{"v2 working set", cgroupV2, helpers.MemoryMetricWorkingSet, 800},
+		{"v2 anon", cgroupV2, helpers.MemoryMetricAnon, 600},
+		{"v2 rss", cgroupV2, helpers.MemoryMetricRSS, 600},
+	}
+
+	for _, tt := range tests {
+		var stats helpers.DockerStats
+		if err := json.Unmarshal([]byte(tt.stats), &stats); err != nil {
+			t.Fatalf("%s: failed to parse stats: %v", tt.name, err)
+		}
+		got, err := stats.MemoryValue(tt.metric)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.name, err)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %d, want %d", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestGetContainerMemoryUsageWorkingSet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"memory_stats": {"usage": 536870912, "limit": 1073741824, "stats": {"inactive_file": 268435456}}}`))
+	}))
+	defer server.Close()
+
+	originalMemoryMetric := helpers.MemoryMetric
+	helpers.MemoryMetric = helpers.MemoryMetricWorkingSet
+	defer func() {
+		helpers.MemoryMetric = originalMemoryMetric
+	}()
+
+	memUsage, _, err := helpers.GetContainerMemoryUsage(server.Client(), "test-container", server.URL, false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if memUsage != 25 {
+		t.Errorf("Expected memory usage 25%%, got %.2f%%", memUsage)
+	}
+}
+
 func TestGetPIDInContainer(t *testing.T) {
 	// Create a mock HTTP server
 	server, client := mockExecInContainer("1234 root      0:00 test-process\n")
@@ -168,7 +230,7 @@ func TestCreateDotnetDump(t *testing.T) {
 	totalMemoryThreshold := 1800.0
 	checkInterval := 1 * time.Second
 
-	output, err := createDotnetDump(client, containerName, pid, dumpFile, totalMemoryThreshold, server.URL, checkInterval, "dotnet-dump")
+	output, err := createDotnetDump(context.Background(), client, containerName, pid, dumpFile, totalMemoryThreshold, server.URL, checkInterval, "dotnet-dump", "")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -197,7 +259,7 @@ func TestCreateMemoryDumpProcdump(t *testing.T) {
 	totalMemoryThreshold := 1800.0
 	checkInterval := 1 * time.Second
 
-	output, err := createMemoryDump(client, containerName, "procdump", pid, dumpFile, totalMemoryThreshold, server.URL, checkInterval)
+	output, err := createMemoryDump(context.Background(), client, containerName, "procdump", pid, dumpFile, totalMemoryThreshold, server.URL, checkInterval, "")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -232,7 +294,7 @@ func TestCreateMemoryDumpDotnetMemory(t *testing.T) {
 	totalMemoryThreshold := 1800.0
 	checkInterval := 1 * time.Second
 
-	output, err := createMemoryDump(client, containerName, "dotnet-dump", pid, dumpFile, totalMemoryThreshold, server.URL, checkInterval)
+	output, err := createMemoryDump(context.Background(), client, containerName, "dotnet-dump", pid, dumpFile, totalMemoryThreshold, server.URL, checkInterval, "")
 	if err != nil {
 		t.Errorf("Unexpected error: %v", err)
 	}
@@ -396,3 +458,97 @@ func TestInstallDumpToolDotMemoryInstalled(t *testing.T) {
 		t.Errorf("Unexpected output: got %q, want %q", string(testBodyOutput), expectedOutput)
 	}
 }
+
+func TestCopyFromContainer(t *testing.T) {
+	content := []byte("memory dump content")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/containers/test-container/archive" || r.URL.Query().Get("path") != "/tmp/dumps/test.dmp" {
+			http.Error(w, "Not found", http.StatusNotFound)
+			return
+		}
+		tw := tar.NewWriter(w)
+		tw.WriteHeader(&tar.Header{Name: "test.dmp", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write(content)
+		tw.Close()
+	}))
+	defer server.Close()
+
+	dstPath := filepath.Join(t.TempDir(), "test.dmp")
+	err := helpers.CopyFromContainer(server.Client(), "test-container", "/tmp/dumps/test.dmp", dstPath, server.URL, helpers.Compression{})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	got, err := os.ReadFile(dstPath)
+	if err != nil {
+		t.Fatalf("Failed to read copied file: %v", err)
+	}
+	if string(got) != string(content) {
+		t.Errorf("Unexpected file content: got %q, want %q", string(got), string(content))
+	}
+}
+
+func TestCopyFromContainerNotFound(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Not found", http.StatusNotFound)
+	}))
+	defer server.Close()
+
+	dstPath := filepath.Join(t.TempDir(), "test.dmp")
+	err := helpers.CopyFromContainer(server.Client(), "test-container", "/tmp/dumps/test.dmp", dstPath, server.URL, helpers.Compression{})
+	if err == nil {
+		t.Fatal("Expected an error, got nil")
+	}
+	if _, statErr := os.Stat(dstPath); !os.IsNotExist(statErr) {
+		t.Errorf("Expected no file at %s", dstPath)
+	}
+}
+
+func TestCopyFromContainerCompressed(t *testing.T) {
+	content := bytes.Repeat([]byte("memory dump content "), 4096)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tw := tar.NewWriter(w)
+		tw.WriteHeader(&tar.Header{Name: "test.dmp", Mode: 0o644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write(content)
+		tw.Close()
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		compression helpers.Compression
+		decompress  func(io.Reader) (io.Reader, error)
+	}{
+		{helpers.Compression{Algorithm: helpers.CompressionGzip, Level: 9}, func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) }},
+		{helpers.Compression{Algorithm: helpers.CompressionZstd}, func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) }},
+	}
+	for _, tt := range tests {
+		dstPath := filepath.Join(t.TempDir(), "test.dmp"+tt.compression.Extension())
+		err := helpers.CopyFromContainer(server.Client(), "test-container", "/tmp/dumps/test.dmp", dstPath, server.URL, tt.compression)
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.compression.Algorithm, err)
+		}
+
+		f, err := os.Open(dstPath)
+		if err != nil {
+			t.Fatalf("%s: failed to open copied file: %v", tt.compression.Algorithm, err)
+		}
+		defer f.Close()
+		if info, _ := f.Stat(); info.Size() >= int64(len(content)) {
+			t.Errorf("%s: expected a compressed file, got %d bytes", tt.compression.Algorithm, info.Size())
+		}
+		r, err := tt.decompress(f)
+		if err != nil {
+			t.Fatalf("%s: failed to decompress: %v", tt.compression.Algorithm, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(got, content) {
+			t.Errorf("%s: unexpected decompressed content (%d bytes, %v)", tt.compression.Algorithm, len(got), err)
+		}
+	}
+
+	for _, compression := range []helpers.Compression{{Algorithm: "lz4"}, {Algorithm: helpers.CompressionGzip, Level: 12}} {
+		if err := compression.Validate(); err == nil {
+			t.Errorf("Expected an error for %+v", compression)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// manifestExtension is appended to the dump file name for its manifest.
+const manifestExtension = ".json"
+
+// dumpManifest describes a dump saved to the host dump directory. It is
+// written next to the dump as <dump file>.json.
+type dumpManifest struct {
+	Container     string    `json:"container"`
+	ContainerID   string    `json:"container_id,omitempty"`
+	Image         string    `json:"image,omitempty"`
+	ImageDigest   string    `json:"image_digest,omitempty"`
+	Process       string    `json:"process"`
+	PID           int       `json:"pid"`
+	DumpTool      string    `json:"dump_tool"`
+	ToolVersion   string    `json:"dump_tool_version,omitempty"`
+	DumpType      string    `json:"dump_type"`
+	Reason        string    `json:"trigger_reason"`
+	MemoryUsageMB float64   `json:"memory_usage_mb"`
+	MemoryLimitMB uint64    `json:"memory_limit_mb"`
+	HostName      string    `json:"host_name,omitempty"`
+	SeriesID      string    `json:"series_id,omitempty"`
+	SeriesIndex   int       `json:"series_index,omitempty"`
+	StartTime     time.Time `json:"start_time"`
+	EndTime       time.Time `json:"end_time"`
+	File          string    `json:"file"`
+	Compression   string    `json:"compression,omitempty"`
+	Size          int64     `json:"size"`
+	SHA256        string    `json:"sha256"`
+	// Sinks records whether the dump was stored in each configured sink
+	Sinks []sinkResult `json:"sinks,omitempty"`
+}
+
+// newManifest starts the manifest of a dump triggered for reason, with the
+// container details and the memory usage at trigger time. Details the Docker
+// API cannot provide are left empty.
+func (m *containerMonitor) newManifest(reason string) dumpManifest {
+	manifest := dumpManifest{
+		Container:     m.target.Container,
+		Process:       m.target.Process,
+		DumpTool:      m.target.DumpTool,
+		Reason:        reason,
+		MemoryUsageMB: m.lastUsageMB,
+		MemoryLimitMB: m.memoryLimitMB,
+		StartTime:     time.Now(),
+	}
+	// The baseline dump is index 0 of its series
+	if m.series != nil && m.series.id != "" {
+		manifest.SeriesID, manifest.SeriesIndex = m.series.id, m.series.index
+	}
+	if m.settings.compression.Algorithm != helpers.CompressionNone {
+		manifest.Compression = m.settings.compression.Algorithm
+	}
+
+	client, baseDockerURL := m.settings.client, m.settings.baseDockerURL
+	inspect, err := helpers.InspectContainer(client, m.target.Container, baseDockerURL)
+	if err != nil {
+		m.logf("Error inspecting container for the dump manifest: %v", err)
+	} else {
+		manifest.ContainerID, manifest.Image, manifest.ImageDigest = inspect.ID, inspect.Config.Image, inspect.Image
+		// Prefer the registry digest over the local image ID
+		image, err := helpers.InspectImage(client, inspect.Image, baseDockerURL)
+		if err == nil && len(image.RepoDigests) > 0 {
+			manifest.ImageDigest = image.RepoDigests[0]
+		}
+	}
+	manifest.HostName, err = helpers.GetDockerHostName(client, baseDockerURL)
+	if err != nil || manifest.HostName == "" {
+		manifest.HostName, _ = os.Hostname()
+	}
+	return manifest
+}
+
+// saveDumps completes the manifest of each dump file saved to the host with
+// its size and checksum, stores the file in the sinks, and writes the
+// manifest next to it and to the sinks. It returns the saved files.
+func (m *containerMonitor) saveDumps(manifest dumpManifest, files []string) []string {
+	manifest.EndTime = time.Now()
+	for _, file := range files {
+		m.logf("Dump file saved to host: %s", file)
+		manifest.File = file
+		if err := hashDump(&manifest); err != nil {
+			m.logf("Error writing dump manifest: %v", err)
+			continue
+		}
+		m.storeDump(&manifest)
+		if err := saveManifest(manifest); err != nil {
+			m.logf("Error writing dump manifest: %v", err)
+			continue
+		}
+		if len(m.settings.sinks) == 0 || !m.storeManifest(manifest) || !m.settings.deleteStored {
+			continue
+		}
+		for _, file := range []string{manifest.File, manifest.File + manifestExtension} {
+			if err := os.Remove(file); err != nil {
+				m.logf("Error deleting stored file: %v", err)
+				continue
+			}
+			m.logf("Deleted %s after storing it in every sink", file)
+		}
+	}
+	return files
+}
+
+// hashDump fills in the size and SHA-256 of manifest.File.
+func hashDump(manifest *dumpManifest) error {
+	f, err := os.Open(manifest.File)
+	if err != nil {
+		return fmt.Errorf("failed to open dump file: %v", err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	manifest.Size, err = io.Copy(hash, f)
+	if err != nil {
+		return fmt.Errorf("failed to hash dump file: %v", err)
+	}
+	manifest.SHA256 = hex.EncodeToString(hash.Sum(nil))
+	return nil
+}
+
+// saveManifest writes the manifest next to its dump.
+func saveManifest(manifest dumpManifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal dump manifest: %v", err)
+	}
+	path := manifest.File + manifestExtension
+	if err := os.WriteFile(path+".part", append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write dump manifest: %v", err)
+	}
+	return os.Rename(path+".part", path)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func TestNewManifest(t *testing.T) {
+	originalInspectContainer := helpers.InspectContainer
+	helpers.InspectContainer = func(client *http.Client, containerName, baseDockerURL string) (helpers.ContainerInspect, error) {
+		var inspect helpers.ContainerInspect
+		inspect.ID = "0123456789abcdef"
+		inspect.Image = "sha256:feedface"
+		inspect.Config.Image = "nethermind/nethermind:1.29.0"
+		return inspect, nil
+	}
+	originalInspectImage := helpers.InspectImage
+	helpers.InspectImage = func(client *http.Client, image, baseDockerURL string) (helpers.ImageInspect, error) {
+		return helpers.ImageInspect{ID: image, RepoDigests: []string{"nethermind/nethermind@sha256:cafebabe"}}, nil
+	}
+	originalGetDockerHostName := helpers.GetDockerHostName
+	helpers.GetDockerHostName = func(client *http.Client, baseDockerURL string) (string, error) {
+		return "node-host-1", nil
+	}
+	defer func() {
+		helpers.InspectContainer = originalInspectContainer
+		helpers.InspectImage = originalInspectImage
+		helpers.GetDockerHostName = originalGetDockerHostName
+	}()
+
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1}
+	m, err := newContainerMonitor(monitorSettings{}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.lastUsageMB, m.memoryLimitMB = 3686, 4096
+
+	manifest := m.newManifest("memory usage 90.00% exceeded the threshold of 90.00%")
+	if manifest.ContainerID != "0123456789abcdef" || manifest.Image != "nethermind/nethermind:1.29.0" || manifest.ImageDigest != "nethermind/nethermind@sha256:cafebabe" {
+		t.Errorf("Unexpected container details: %+v", manifest)
+	}
+	if manifest.HostName != "node-host-1" || manifest.MemoryUsageMB != 3686 || manifest.MemoryLimitMB != 4096 {
+		t.Errorf("Unexpected manifest: %+v", manifest)
+	}
+	if dumpType := m.effectiveDumpType(""); dumpType != dumpTypeFull {
+		t.Errorf("Expected procdump to default to full dumps, got %s", dumpType)
+	}
+	if manifest.SeriesID != "" {
+		t.Errorf("Expected no series ID without a series, got %s", manifest.SeriesID)
+	}
+
+	// The baseline dump of a series is index 0
+	m.series = &dumpSeries{stepMB: 500}
+	m.series.begin()
+	manifest = m.newManifest("memory usage 90.00% exceeded the threshold of 90.00%")
+	if manifest.SeriesID != m.series.id || manifest.SeriesIndex != 0 {
+		t.Errorf("Expected the baseline manifest in series %s at index 0, got %s at %d", m.series.id, manifest.SeriesID, manifest.SeriesIndex)
+	}
+	m.series.record(3686, time.Now())
+	manifest = m.newManifest("series follow-up")
+	if manifest.SeriesID != m.series.id || manifest.SeriesIndex != 1 {
+		t.Errorf("Expected the follow-up manifest in series %s at index 1, got %s at %d", m.series.id, manifest.SeriesID, manifest.SeriesIndex)
+	}
+}
+
+func TestSaveManifest(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "core_1234_1.dmp")
+	if err := os.WriteFile(file, []byte("memory dump content"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := dumpManifest{Container: "test-container", PID: 1234, DumpTool: "procdump", DumpType: dumpTypeFull, File: file}
+	if err := hashDump(&manifest); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := saveManifest(manifest); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	data, err := os.ReadFile(file + manifestExtension)
+	if err != nil {
+		t.Fatalf("Failed to read manifest: %v", err)
+	}
+	var saved map[string]interface{}
+	if err := json.Unmarshal(data, &saved); err != nil {
+		t.Fatalf("Failed to parse manifest: %v", err)
+	}
+	// sha256 of "memory dump content"
+	expectedSHA256 := "90f1a001e7ed7056c5b38f5aab0e33b5cbc26c1c872d04555aed5293c7f61182"
+	if saved["size"] != float64(19) || saved["container"] != "test-container" || saved["pid"] != float64(1234) {
+		t.Errorf("Unexpected manifest: %s", data)
+	}
+	if saved["sha256"] != expectedSHA256 {
+		t.Errorf("Unexpected sha256: got %v, want %s", saved["sha256"], expectedSHA256)
+	}
+
+	if err := hashDump(&dumpManifest{File: file + ".missing"}); err == nil {
+		t.Error("Expected an error for a missing dump file")
+	}
+}
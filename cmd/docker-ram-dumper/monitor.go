@@ -0,0 +1,546 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// monitorSettings holds the settings shared by all container monitors.
+type monitorSettings struct {
+	client           *http.Client
+	baseDockerURL    string
+	dumpDirContainer string
+	dumpDirHost      string
+	checkInterval    time.Duration
+	monitor          bool
+	cleanup          bool
+	hostMode         bool
+	// processMemory selects a per-process metric compared against the
+	// threshold instead of the whole container usage
+	processMemory string
+	// forecastWindow is the period of samples used to forecast the time to OOM
+	forecastWindow time.Duration
+	// cgroup trigger settings: the host cgroup v2 root, the memory pressure
+	// avg10 limits and the memory.events counters to watch
+	cgroupRoot   string
+	psiSome      float64
+	psiFull      float64
+	memoryEvents []string
+	// minFreeSpaceMB is the space that must stay free in the dump
+	// directories once the dump is written
+	minFreeSpaceMB float64
+	// retention limits the dumps kept in the host dump directory
+	retention retentionPolicy
+	// compression is applied to the dumps while they are copied to the host
+	compression helpers.Compression
+	// dumps are copied from the container in chunks of copyChunkSize bytes,
+	// each retried copyRetries times before the copy fails
+	copyChunkSize int64
+	copyRetries   int
+	// sinks store the dumps and their manifests once saved to the host,
+	// deleting the local files once every sink stored them with deleteStored
+	sinks        []Sink
+	deleteStored bool
+}
+
+// containerMonitor watches the memory usage of a single container and
+// creates dumps of its process. Each monitor runs in its own goroutine.
+type containerMonitor struct {
+	settings monitorSettings
+	target   targetConfig
+	tool     DumpTool
+
+	state                string
+	dumpCounter          int
+	thresholdValue       float64
+	totalMemoryThreshold float64
+
+	// events receives the Docker events of the container
+	events           chan helpers.DockerEvent
+	paused           bool
+	memoryLimitMB    uint64
+	lastUsagePercent float64
+	lastUsageMB      float64
+
+	// triggers can start a dump below the threshold
+	triggers []trigger
+	history  memoryHistory
+	// series is set when follow-up dumps are taken after the first one
+	series *dumpSeries
+	gate   dumpGate
+}
+
+func newContainerMonitor(settings monitorSettings, target targetConfig) (*containerMonitor, error) {
+	tool, err := getDumpTool(target.DumpTool)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", target.Container, err)
+	}
+	if _, ok := tool.(hostCapturer); settings.hostMode && !ok {
+		return nil, fmt.Errorf("%s: %s does not support -host-mode", target.Container, target.DumpTool)
+	}
+	if target.DumpType != "" && !slices.Contains(tool.DumpTypes(), target.DumpType) {
+		return nil, fmt.Errorf("%s: %s does not support %s dumps (supported: %s)", target.Container, target.DumpTool, target.DumpType, strings.Join(tool.DumpTypes(), ", "))
+	}
+	if _, ok := processMemoryFields[settings.processMemory]; settings.processMemory != "" && !ok {
+		return nil, fmt.Errorf("unsupported process memory metric: %s (supported: %s)", settings.processMemory, strings.Join(processMemoryMetrics(), ", "))
+	}
+	if _, _, err := parseThreshold(target.Threshold); err != nil {
+		return nil, fmt.Errorf("%s: %v", target.Container, err)
+	}
+
+	m := &containerMonitor{settings: settings, target: target, tool: tool, events: make(chan helpers.DockerEvent, 16)}
+	if target.Growth != "" {
+		growth, err := parseGrowthTrigger(target.Growth)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", target.Container, err)
+		}
+		m.triggers = append(m.triggers, growth)
+	}
+	if target.OOMHorizon != "" {
+		horizon, err := time.ParseDuration(target.OOMHorizon)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid OOM horizon %q: %v", target.Container, target.OOMHorizon, err)
+		}
+		m.triggers = append(m.triggers, &forecastTrigger{horizon: horizon, period: settings.forecastWindow})
+	}
+	for _, name := range settings.memoryEvents {
+		if !slices.Contains(memoryEventNames, name) {
+			return nil, fmt.Errorf("unsupported memory event: %s (supported: %s)", name, strings.Join(memoryEventNames, ", "))
+		}
+	}
+	if settings.psiSome > 0 || settings.psiFull > 0 || len(settings.memoryEvents) > 0 {
+		m.triggers = append(m.triggers, &cgroupTrigger{
+			root:    settings.cgroupRoot,
+			psiSome: settings.psiSome,
+			psiFull: settings.psiFull,
+			events:  settings.memoryEvents,
+		})
+	}
+	if target.RuntimeCounters != "" {
+		if target.DumpTool != "dotnet-dump" && target.DumpTool != "dotMemory" {
+			return nil, fmt.Errorf("%s: runtime counters are only supported with dotnet-dump and dotMemory", target.Container)
+		}
+		if settings.hostMode {
+			return nil, fmt.Errorf("%s: runtime counters are not supported with -host-mode", target.Container)
+		}
+		rules, err := parseRuntimeCounterRules(target.RuntimeCounters)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", target.Container, err)
+		}
+		m.triggers = append(m.triggers, &runtimeCounterTrigger{rules: rules})
+	}
+	m.series, err = newDumpSeries(target.SeriesStep, target.SeriesInterval)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", target.Container, err)
+	}
+	m.gate.cooldown, err = parseCooldown(target.Cooldown)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", target.Container, err)
+	}
+	if target.Rearm != "" {
+		if _, _, err := parseThreshold(target.Rearm); err != nil {
+			return nil, fmt.Errorf("%s: invalid re-arm watermark: %v", target.Container, err)
+		}
+	}
+	for _, t := range m.triggers {
+		m.history.maxAge = max(m.history.maxAge, t.window()+settings.checkInterval)
+	}
+	return m, nil
+}
+
+func (m *containerMonitor) logf(format string, args ...interface{}) {
+	fmt.Printf("[%s] "+format+"\n", append([]interface{}{m.target.Container}, args...)...)
+}
+
+func (m *containerMonitor) setState(state string) {
+	if m.state == state {
+		return
+	}
+	m.state = state
+	m.logf("State: %s (dumps: %d/%d)", state, m.dumpCounter, m.target.DumpsCount)
+}
+
+func (m *containerMonitor) dumpTarget() dumpTarget {
+	return dumpTarget{client: m.settings.client, containerName: m.target.Container, baseDockerURL: m.settings.baseDockerURL}
+}
+
+// sleep waits for the check interval while handling container events, and
+// reports false if ctx is done first. While the container is stopped it keeps
+// waiting until the container starts again.
+func (m *containerMonitor) sleep(ctx context.Context) bool {
+	timer := time.NewTimer(m.settings.checkInterval)
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return false
+		case event := <-m.events:
+			if m.handleEvent(event) {
+				return true
+			}
+		case <-timer.C:
+			if !m.paused {
+				return true
+			}
+			timer.Reset(m.settings.checkInterval)
+		}
+	}
+}
+
+// resolveThreshold converts the target threshold into both a percentage and
+// an absolute value in MB, based on the container memory limit.
+func (m *containerMonitor) resolveThreshold() {
+	client, containerName, baseDockerURL := m.settings.client, m.target.Container, m.settings.baseDockerURL
+	thresholdValue, isPercentage, _ := parseThreshold(m.target.Threshold)
+	_, totalMemory, _ := helpers.GetContainerMemoryUsage(client, containerName, baseDockerURL, true)
+	m.memoryLimitMB = totalMemory
+	if isPercentage {
+		m.totalMemoryThreshold = float64(totalMemory) * thresholdValue / 100
+	} else {
+		m.totalMemoryThreshold = thresholdValue
+		thresholdValue = thresholdValue / float64(totalMemory) * 100
+	}
+	m.thresholdValue = thresholdValue
+	m.logf("Total memory threshold: %.0f%% (%.0f MB)", m.thresholdValue, m.totalMemoryThreshold)
+	m.resolveRearm()
+}
+
+func (m *containerMonitor) run(ctx context.Context) {
+	client, containerName, baseDockerURL := m.settings.client, m.target.Container, m.settings.baseDockerURL
+	if m.settings.cleanup && !m.settings.hostMode {
+		defer cleanupDumps(client, containerName, m.settings.dumpDirContainer, baseDockerURL)
+		defer m.tool.Cleanup(m.dumpTarget())
+	}
+	defer func() {
+		if m.state != "done" && m.state != "failed" {
+			m.setState("stopped")
+		}
+	}()
+
+	m.resolveThreshold()
+	for {
+		if ctx.Err() != nil {
+			return
+		}
+		m.setState("monitoring")
+		// Get memory usage
+		memUsagePercent, err := m.memoryUsage()
+		if err != nil {
+			m.logf("Error getting memory usage: %v", err)
+			if !m.settings.monitor {
+				m.logf("'-monitor' flag is set to false. Stopping.")
+				m.setState("failed")
+				return
+			}
+			if !m.sleep(ctx) {
+				return
+			}
+			continue
+		}
+
+		m.logf("Memory usage is %.2f%%", memUsagePercent)
+		m.logForecast()
+
+		if reason, captureThreshold := m.evaluateTriggers(); reason != "" {
+			m.logf("Dump triggered: %s. Initiating memory dump...", reason)
+			m.setState("dumping")
+			if m.series != nil {
+				m.series.begin()
+			}
+
+			files, retry, err := m.dump(ctx, reason, captureThreshold)
+			var skipped *dumpSkippedError
+			if errors.As(err, &skipped) {
+				m.logf("Dump skipped: %v", skipped)
+				err := appendHistory(m.settings.dumpDirHost, historyEntry{
+					Time:               time.Now(),
+					Container:          containerName,
+					Event:              "skipped",
+					MemoryUsageMB:      m.lastUsageMB,
+					MemoryUsagePercent: m.lastUsagePercent,
+					Reason:             reason + "; " + skipped.reason,
+				})
+				if err != nil {
+					m.logf("Error recording dump history: %v", err)
+				}
+				if !m.sleep(ctx) {
+					return
+				}
+				continue
+			}
+			if err != nil {
+				m.logf("Dump failed: %v", err)
+				if !retry {
+					m.setState("failed")
+					return
+				}
+				if !m.sleep(ctx) {
+					return
+				}
+				continue
+			}
+
+			m.dumpCounter++
+			entry := historyEntry{
+				Time:               time.Now(),
+				Container:          containerName,
+				Event:              "dump",
+				MemoryUsageMB:      m.lastUsageMB,
+				MemoryUsagePercent: m.lastUsagePercent,
+				Reason:             reason,
+				Files:              files,
+			}
+			if m.series != nil {
+				entry.SeriesID, entry.SeriesIndex = m.series.id, m.series.index
+				m.series.record(m.lastUsageMB, entry.Time)
+			}
+			m.recordDump(entry.Time)
+			err = appendHistory(m.settings.dumpDirHost, entry)
+			if err != nil {
+				m.logf("Error recording dump history: %v", err)
+			}
+			if m.settings.retention.enabled() {
+				if _, err := applyRetention(m.settings.dumpDirHost, m.settings.retention, files, time.Now()); err != nil {
+					m.logf("Error applying dump retention: %v", err)
+				}
+			}
+			if m.dumpCounter >= m.target.DumpsCount {
+				m.logf("Reached the limit of %d dumps. Stopping.", m.target.DumpsCount)
+				m.setState("done")
+				return
+			}
+		} else {
+			if m.series != nil && m.series.started() {
+				if !m.settings.monitor {
+					m.logf("'-monitor' flag is set to false. Not waiting for the follow-up dumps of series %s. Stopping.", m.series.id)
+					return
+				}
+				m.logf("Waiting for follow-up dump %d of series %s...", m.series.index, m.series.id)
+			} else {
+				m.logf("Memory usage (%.2f%%) is below the threshold (%.2f%%).", memUsagePercent, m.thresholdValue)
+				if !m.settings.monitor {
+					m.logf("'-monitor' flag is set to false. Dumping only once. Stopping.")
+					return
+				}
+				m.logf("Waiting for memory usage to exceed the threshold...")
+			}
+		}
+
+		if !m.sleep(ctx) {
+			return
+		}
+	}
+}
+
+// memoryUsage returns the memory usage compared against the threshold, as a
+// percentage of the container memory limit. It is the container usage, or the
+// memory of the monitored process when -process-memory is set.
+func (m *containerMonitor) memoryUsage() (float64, error) {
+	memUsagePercent, _, err := helpers.GetContainerMemoryUsage(m.settings.client, m.target.Container, m.settings.baseDockerURL, false)
+	if err != nil {
+		return 0, err
+	}
+	memUsageMB := memUsagePercent * float64(m.memoryLimitMB) / 100
+
+	if m.settings.processMemory != "" {
+		processMB, err := m.processMemoryUsage()
+		if err != nil {
+			return 0, fmt.Errorf("failed to get memory of process %s: %v", m.target.Process, err)
+		}
+		m.logf("Process %s memory (%s): %.0f MB, container: %.0f MB", m.target.Process, m.settings.processMemory, processMB, memUsageMB)
+		memUsageMB = processMB
+		memUsagePercent = processMB / float64(m.memoryLimitMB) * 100
+	}
+
+	m.lastUsagePercent = memUsagePercent
+	m.lastUsageMB = memUsageMB
+	m.history.add(memorySample{time: time.Now(), usageMB: memUsageMB, percent: memUsagePercent})
+	return memUsagePercent, nil
+}
+
+// evaluateTriggers checks the last memory reading against the threshold and
+// the other triggers. It returns the reason to take a dump, if any, and the
+// memory threshold in MB the dump tool should wait for: the threshold itself
+// when it was exceeded, 0 to capture right away for the other triggers.
+func (m *containerMonitor) evaluateTriggers() (string, float64) {
+	// Once a series is started only its follow-up rules create dumps
+	if m.series != nil && m.series.started() {
+		if len(m.history.samples) == 0 {
+			return "", 0
+		}
+		return m.series.next(m.history.samples[len(m.history.samples)-1]), 0
+	}
+	if !m.dumpAllowed(time.Now()) {
+		return "", 0
+	}
+	if m.lastUsagePercent >= m.thresholdValue {
+		return fmt.Sprintf("memory usage %.2f%% exceeded the threshold of %.2f%%", m.lastUsagePercent, m.thresholdValue), m.totalMemoryThreshold
+	}
+	if len(m.history.samples) == 0 {
+		return "", 0
+	}
+	now := m.history.samples[len(m.history.samples)-1]
+	for _, t := range m.triggers {
+		if reason := t.check(m, now); reason != "" {
+			return reason, 0
+		}
+	}
+	return "", 0
+}
+
+// dump creates a memory dump triggered for reason, saves it to the host dump
+// directory with its manifest and returns the saved files. The dump tool
+// waits for the memory usage to reach captureThreshold MB, or captures right
+// away when it is 0, and stops waiting when ctx is done. When it fails, retry
+// reports whether the monitor should try again later.
+func (m *containerMonitor) dump(ctx context.Context, reason string, captureThreshold float64) (files []string, retry bool, err error) {
+	client, containerName, baseDockerURL := m.settings.client, m.target.Container, m.settings.baseDockerURL
+	processName, dumpTool := m.target.Process, m.target.DumpTool
+	manifest := m.newManifest(reason)
+
+	if m.settings.hostMode {
+		dumpType, err := m.planDump(captureThreshold)
+		if err != nil {
+			return nil, true, err
+		}
+		manifest.DumpType = m.effectiveDumpType(dumpType)
+		files, pid, toolVersion, err := captureFromHost(ctx, client, containerName, processName, m.tool, m.settings.dumpDirHost, m.dumpFileName, captureThreshold, baseDockerURL, m.settings.checkInterval, dumpType)
+		if err != nil {
+			return nil, true, fmt.Errorf("error creating dump from the host namespace: %v", err)
+		}
+		manifest.PID, manifest.ToolVersion = pid, toolVersion
+		return m.saveDumps(manifest, files), false, nil
+	}
+
+	// Install dependencies inside the target container
+	_, err = installDumpTool(client, containerName, dumpTool, baseDockerURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("error installing dump tool: %v", err)
+	}
+
+	// Get the PID of the processName process inside the target container
+	pid, err := helpers.GetPIDInContainer(client, containerName, processName, baseDockerURL)
+	if err != nil {
+		return nil, false, fmt.Errorf("error getting PID: %v (check that the process name is correct and the container is running)", err)
+	}
+	m.logf("PID of %s is %d", processName, pid)
+
+	// Create a dump directory inside the container
+	_, err = helpers.ExecInContainer(client, containerName, baseDockerURL, "mkdir", "-p", m.settings.dumpDirContainer)
+	if err != nil {
+		return nil, false, fmt.Errorf("error creating dump directory in container: %v", err)
+	}
+
+	// Make sure the dump fits in the container and on the host
+	dumpType, err := m.planDump(captureThreshold)
+	if err != nil {
+		return nil, true, err
+	}
+
+	manifest.PID, manifest.DumpType = pid, m.effectiveDumpType(dumpType)
+	manifest.ToolVersion = m.tool.Version(dumpTarget{client: client, containerName: containerName, baseDockerURL: baseDockerURL})
+
+	// Run the selected dump tool inside the target container
+	dumpFile := filepath.Join(m.settings.dumpDirContainer, m.dumpFileName(pid))
+	dumpOutput, err := createMemoryDump(ctx, client, containerName, dumpTool, pid, dumpFile, captureThreshold, baseDockerURL, m.settings.checkInterval, dumpType)
+	if err != nil {
+		return nil, true, fmt.Errorf("error creating dump: %v, command output: %s", err, dumpOutput)
+	}
+
+	// Copy the dump files from the target container to the host
+	files, err = m.copyDumpFiles(dumpFile, pid)
+	if err != nil {
+		return nil, true, err
+	}
+	return m.saveDumps(manifest, files), false, nil
+}
+
+// copyDumpFiles copies the files the tool wrote for dumpFile to the host dump
+// directory. When one of them cannot be copied and verified, the files
+// copied so far are removed and the dump fails.
+func (m *containerMonitor) copyDumpFiles(dumpFile string, pid int) ([]string, error) {
+	var files []string
+	for _, outputFile := range m.tool.OutputFiles(dumpFile, pid) {
+		hostDumpFile := filepath.Join(m.settings.dumpDirHost, filepath.Base(outputFile)+m.settings.compression.Extension())
+		m.logf("Trying to save memory dump %s to %s on the host ...", outputFile, hostDumpFile)
+		if err := m.copyFromContainer(outputFile, hostDumpFile); err != nil {
+			for _, file := range files {
+				os.Remove(file)
+			}
+			return nil, fmt.Errorf("error copying dump file to host: %v", err)
+		}
+		files = append(files, hostDumpFile)
+	}
+	return files, nil
+}
+
+// effectiveDumpType returns the dump type the tool captures for dumpType,
+// resolving the tool default.
+func (m *containerMonitor) effectiveDumpType(dumpType string) string {
+	if dumpType == "" {
+		return m.tool.DumpTypes()[0]
+	}
+	return dumpType
+}
+
+// dumpFileName returns the name of the next dump of process pid.
+func (m *containerMonitor) dumpFileName(pid int) string {
+	if m.series != nil {
+		return fmt.Sprintf("core_%d_%d_%s.dmp", pid, time.Now().Unix(), m.series.tag())
+	}
+	return fmt.Sprintf("core_%d_%d.dmp", pid, time.Now().Unix())
+}
+
+// monitorGroup runs container monitors concurrently and keeps track of them
+// for the final report.
+type monitorGroup struct {
+	wg       sync.WaitGroup
+	mu       sync.Mutex
+	monitors []*containerMonitor
+}
+
+func (g *monitorGroup) start(ctx context.Context, m *containerMonitor) {
+	g.mu.Lock()
+	g.monitors = append(g.monitors, m)
+	g.mu.Unlock()
+
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		m.run(ctx)
+	}()
+}
+
+// wait blocks until all monitors have stopped and returns them.
+func (g *monitorGroup) wait() []*containerMonitor {
+	g.wg.Wait()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.monitors
+}
+
+// route forwards a container event to the monitors of that container.
+func (g *monitorGroup) route(event helpers.DockerEvent) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, m := range g.monitors {
+		if !m.matches(event) {
+			continue
+		}
+		select {
+		case m.events <- event:
+		default:
+			m.logf("Dropping %s event, the monitor is busy", event.Action)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// processMemoryFields maps the -process-memory values to the /proc/<pid>/status
+// fields they read.
+var processMemoryFields = map[string]string{
+	"rss":      "VmRSS",
+	"rss-anon": "RssAnon",
+}
+
+func processMemoryMetrics() []string {
+	metrics := make([]string, 0, len(processMemoryFields))
+	for metric := range processMemoryFields {
+		metrics = append(metrics, metric)
+	}
+	sort.Strings(metrics)
+	return metrics
+}
+
+// processMemoryUsage returns the memory of the monitored process in MB, read
+// from its /proc/<pid>/status.
+func (m *containerMonitor) processMemoryUsage() (float64, error) {
+	field, ok := processMemoryFields[m.settings.processMemory]
+	if !ok {
+		return 0, fmt.Errorf("unsupported process memory metric: %s (supported: %s)", m.settings.processMemory, strings.Join(processMemoryMetrics(), ", "))
+	}
+	status, err := m.processStatus()
+	if err != nil {
+		return 0, err
+	}
+	kB, err := parseProcStatusKB(status, field)
+	if err != nil {
+		return 0, err
+	}
+	return float64(kB) / 1024, nil
+}
+
+// processStatus reads /proc/<pid>/status of the monitored process, through the
+// host procfs in host mode and by exec-ing cat in the container otherwise.
+func (m *containerMonitor) processStatus() (string, error) {
+	client, containerName, baseDockerURL := m.settings.client, m.target.Container, m.settings.baseDockerURL
+	if m.settings.hostMode {
+		initPID, err := helpers.GetContainerHostPID(client, containerName, baseDockerURL)
+		if err != nil {
+			return "", err
+		}
+		hostPID, _, err := findHostPID(hostProcRoot, initPID, m.target.Process)
+		if err != nil {
+			return "", err
+		}
+		status, err := os.ReadFile(filepath.Join(hostProcRoot, strconv.Itoa(hostPID), "status"))
+		if err != nil {
+			return "", fmt.Errorf("failed to read status of process %d: %v", hostPID, err)
+		}
+		return string(status), nil
+	}
+
+	pid, err := helpers.GetPIDInContainer(client, containerName, m.target.Process, baseDockerURL)
+	if err != nil {
+		return "", err
+	}
+	status, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "cat", fmt.Sprintf("/proc/%d/status", pid))
+	if err != nil {
+		return "", err
+	}
+	return helpers.DemuxExecOutput(status), nil
+}
+
+// parseProcStatusKB returns the value in kB of a field of /proc/<pid>/status,
+// e.g. "VmRSS:	  123456 kB".
+func parseProcStatusKB(status, field string) (uint64, error) {
+	for _, line := range strings.Split(status, "\n") {
+		if !strings.HasPrefix(line, field+":") {
+			continue
+		}
+		fields := strings.Fields(strings.TrimPrefix(line, field+":"))
+		if len(fields) == 0 {
+			break
+		}
+		return strconv.ParseUint(fields[0], 10, 64)
+	}
+	return 0, fmt.Errorf("no %s found in process status", field)
+}
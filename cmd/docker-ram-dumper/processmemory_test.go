@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+const testProcStatus = "Name:\tdotnet\nPid:\t1234\nVmRSS:\t  1048576 kB\nRssAnon:\t   524288 kB\nRssFile:\t   524288 kB\n"
+
+func TestParseProcStatusKB(t *testing.T) {
+	rss, err := parseProcStatusKB(testProcStatus, "VmRSS")
+	if err != nil || rss != 1048576 {
+		t.Errorf("Unexpected VmRSS: got %d (%v), want 1048576", rss, err)
+	}
+	anon, err := parseProcStatusKB(testProcStatus, "RssAnon")
+	if err != nil || anon != 524288 {
+		t.Errorf("Unexpected RssAnon: got %d (%v), want 524288", anon, err)
+	}
+	if _, err := parseProcStatusKB(testProcStatus, "VmSwap"); err == nil {
+		t.Error("Expected an error for a missing field")
+	}
+}
+
+func TestMonitorProcessMemoryUsage(t *testing.T) {
+	originalGetContainerMemoryUsage := helpers.GetContainerMemoryUsage
+	helpers.GetContainerMemoryUsage = func(client *http.Client, containerName, baseDockerURL string, getTotalMemory bool) (float64, uint64, error) {
+		return 80.0, 4096, nil
+	}
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		if strings.Join(command, " ") == "cat /proc/1234/status" {
+			// The RssAnon line is split across two frames
+			split := strings.Index(testProcStatus, "524288")
+			return execFrame(testProcStatus[:split+3]) + execFrame(testProcStatus[split+3:]), nil
+		}
+		return "root      1234     1  0 10:00 ?        00:00:01 dotnet nethermind.dll", nil
+	}
+	defer func() {
+		helpers.GetContainerMemoryUsage = originalGetContainerMemoryUsage
+		helpers.ExecInContainer = originalExecInContainer
+	}()
+
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1}
+	m, err := newContainerMonitor(monitorSettings{checkInterval: time.Second, processMemory: "rss-anon"}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	m.memoryLimitMB = 4096
+
+	memUsagePercent, err := m.memoryUsage()
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	// 512 MB of anonymous memory out of a 4096 MB limit
+	if memUsagePercent != 12.5 || m.lastUsageMB != 512 {
+		t.Errorf("Unexpected process memory usage: got %.2f%% (%.0f MB), want 12.50%% (512 MB)", memUsagePercent, m.lastUsageMB)
+	}
+}
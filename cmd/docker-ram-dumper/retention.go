@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// retentionPolicy limits the dumps kept in the host dump directory. Zero
+// values disable the corresponding limit.
+type retentionPolicy struct {
+	// keepLast is the number of most recent dumps kept per container
+	keepLast int
+	// maxAge is the age after which dumps are deleted
+	maxAge time.Duration
+	// maxTotalMB is the quota of all dumps, the oldest go first
+	maxTotalMB float64
+}
+
+func (p retentionPolicy) enabled() bool {
+	return p.keepLast > 0 || p.maxAge > 0 || p.maxTotalMB > 0
+}
+
+// retainedDump is a dump of the history with the size of its files still on disk.
+type retainedDump struct {
+	historyEntry
+	files  []string
+	sizeMB float64
+}
+
+// applyRetention deletes the dumps of the history in dumpDir that break the
+// policy and returns the deleted files. The dumps are taken from the history
+// file, so only files written by the dumper are ever deleted. The files of
+// protected, the dump just written, are never deleted.
+func applyRetention(dumpDir string, policy retentionPolicy, protected []string, now time.Time) ([]string, error) {
+	historyMu.Lock()
+	defer historyMu.Unlock()
+
+	entries, err := readHistory(dumpDir)
+	if err != nil {
+		return nil, err
+	}
+	var dumps []retainedDump
+	for _, entry := range entries {
+		if entry.Event != "dump" {
+			continue
+		}
+		dump := retainedDump{historyEntry: entry}
+		for _, file := range entry.Files {
+			info, err := os.Stat(file)
+			if err != nil {
+				continue
+			}
+			dump.files = append(dump.files, file)
+			dump.sizeMB += float64(info.Size()) / 1024 / 1024
+		}
+		if len(dump.files) > 0 {
+			dumps = append(dumps, dump)
+		}
+	}
+	sort.SliceStable(dumps, func(i, j int) bool { return dumps[i].Time.Before(dumps[j].Time) })
+
+	isProtected := func(dump retainedDump) bool {
+		for _, file := range dump.files {
+			if slices.Contains(protected, file) {
+				return true
+			}
+		}
+		return false
+	}
+	// expired holds the reason each dump is deleted for
+	expired := make([]string, len(dumps))
+	perContainer := map[string]int{}
+	var totalMB float64
+	// Newest first, so the dumps counted towards keepLast are the most recent
+	for i := len(dumps) - 1; i >= 0; i-- {
+		dump := dumps[i]
+		perContainer[dump.Container]++
+		totalMB += dump.sizeMB
+		if isProtected(dump) {
+			continue
+		}
+		if policy.maxAge > 0 && now.Sub(dump.Time) > policy.maxAge {
+			expired[i] = fmt.Sprintf("older than %v", policy.maxAge)
+		}
+		if policy.keepLast > 0 && perContainer[dump.Container] > policy.keepLast {
+			expired[i] = fmt.Sprintf("more than %d dumps of %s", policy.keepLast, dump.Container)
+		}
+	}
+	for i, dump := range dumps {
+		if expired[i] != "" {
+			totalMB -= dump.sizeMB
+		}
+	}
+	// Oldest first until the remaining dumps fit in the quota
+	for i := 0; policy.maxTotalMB > 0 && totalMB > policy.maxTotalMB && i < len(dumps); i++ {
+		if expired[i] != "" || isProtected(dumps[i]) {
+			continue
+		}
+		expired[i] = fmt.Sprintf("dumps exceed the quota of %.0f MB", policy.maxTotalMB)
+		totalMB -= dumps[i].sizeMB
+	}
+
+	var deleted []string
+	for i, dump := range dumps {
+		if expired[i] == "" {
+			continue
+		}
+		for _, file := range dump.files {
+			if err := os.Remove(file); err != nil {
+				return deleted, fmt.Errorf("failed to delete %s: %v", file, err)
+			}
+			fmt.Printf("Deleted dump %s of %s (%.0f MB): %s\n", file, dump.Container, dump.sizeMB, expired[i])
+			deleted = append(deleted, file)
+			if err := os.Remove(file + manifestExtension); err != nil && !os.IsNotExist(err) {
+				return deleted, fmt.Errorf("failed to delete manifest of %s: %v", file, err)
+			}
+		}
+	}
+	return deleted, nil
+}
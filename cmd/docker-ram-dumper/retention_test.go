@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyRetention(t *testing.T) {
+	now := time.Date(2024, 10, 10, 12, 0, 0, 0, time.UTC)
+	newDumps := func(t *testing.T) (string, []string) {
+		dir := t.TempDir()
+		var files []string
+		// Three 1 MB dumps of node-a a day apart, one of node-b
+		for i, container := range []string{"node-a", "node-a", "node-b", "node-a"} {
+			file := filepath.Join(dir, "core_"+string(rune('0'+i))+".dmp")
+			if err := os.WriteFile(file, make([]byte, 1024*1024), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			entry := historyEntry{Time: now.Add(time.Duration(i-3) * 24 * time.Hour), Container: container, Event: "dump", Files: []string{file}}
+			if err := appendHistory(dir, entry); err != nil {
+				t.Fatal(err)
+			}
+			files = append(files, file)
+		}
+		if err := appendHistory(dir, historyEntry{Time: now, Container: "node-a", Event: "oom"}); err != nil {
+			t.Fatal(err)
+		}
+		return dir, files
+	}
+
+	tests := []struct {
+		name      string
+		policy    retentionPolicy
+		protected int
+		deleted   []int
+	}{
+		{"keep last", retentionPolicy{keepLast: 1}, 3, []int{0, 1}},
+		{"max age", retentionPolicy{maxAge: 36 * time.Hour}, 3, []int{0, 1}},
+		{"quota", retentionPolicy{maxTotalMB: 2.5}, 3, []int{0, 1}},
+		{"protected", retentionPolicy{maxAge: time.Hour}, 0, []int{1, 2}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, files := newDumps(t)
+			deleted, err := applyRetention(dir, tt.policy, []string{files[tt.protected]}, now)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			var expected []string
+			for _, i := range tt.deleted {
+				expected = append(expected, files[i])
+			}
+			if !reflect.DeepEqual(deleted, expected) {
+				t.Errorf("Unexpected deleted files: got %v, want %v", deleted, expected)
+			}
+			for _, file := range deleted {
+				if _, err := os.Stat(file); !os.IsNotExist(err) {
+					t.Errorf("Expected %s to be deleted", file)
+				}
+			}
+
+			// Deleted dumps are skipped on the next run
+			deleted, err = applyRetention(dir, tt.policy, []string{files[tt.protected]}, now)
+			if err != nil || len(deleted) != 0 {
+				t.Errorf("Expected nothing left to delete, got %v (%v)", deleted, err)
+			}
+		})
+	}
+}
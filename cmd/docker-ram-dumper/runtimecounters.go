@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+const (
+	dotnetCountersPath = "/root/.dotnet/tools/dotnet-counters"
+	// runtimeCountersFile is where dotnet-counters writes its JSON report
+	// inside the container.
+	runtimeCountersFile = "/tmp/ram-dumper-counters.json"
+	// runtimeCountersDuration is how long the counters are collected on each
+	// check, long enough for a few one second refreshes.
+	runtimeCountersDuration = 5 * time.Second
+)
+
+// runtimeCounter is a System.Runtime counter of the .NET runtime, with its
+// name in dotnet-counters and the display name used in its reports.
+type runtimeCounter struct {
+	counter string
+	display string
+}
+
+// runtimeCounters maps the counter names accepted in -runtime-counters to the
+// System.Runtime counters.
+var runtimeCounters = map[string]runtimeCounter{
+	"gc-heap-size": {counter: "gc-heap-size", display: "GC Heap Size"},
+	"gen2-size":    {counter: "gen-2-size", display: "Gen 2 Size"},
+	"loh-size":     {counter: "loh-size", display: "LOH Size"},
+	"working-set":  {counter: "working-set", display: "Working Set"},
+}
+
+// runtimeCounterNames returns the sorted counter names accepted in -runtime-counters.
+func runtimeCounterNames() []string {
+	names := make([]string, 0, len(runtimeCounters))
+	for name := range runtimeCounters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// runtimeCounterRule fires when a runtime counter exceeds a limit.
+type runtimeCounterRule struct {
+	name    string
+	limitMB float64
+}
+
+// parseRuntimeCounterRules parses a comma separated list of rules such as
+// "gc-heap-size > 6GB, loh-size > 500MB".
+func parseRuntimeCounterRules(rules string) ([]runtimeCounterRule, error) {
+	var parsed []runtimeCounterRule
+	for _, rule := range splitList(rules) {
+		name, limit, ok := strings.Cut(rule, ">")
+		if !ok {
+			return nil, fmt.Errorf("invalid runtime counter rule %q, expected <counter> > <size>", rule)
+		}
+		name = strings.TrimSpace(name)
+		if _, ok := runtimeCounters[name]; !ok {
+			return nil, fmt.Errorf("unsupported runtime counter: %s (supported: %s)", name, strings.Join(runtimeCounterNames(), ", "))
+		}
+		limitMB, err := parseSizeMB(limit)
+		if err != nil {
+			return nil, fmt.Errorf("invalid runtime counter rule %q: %v", rule, err)
+		}
+		if limitMB <= 0 {
+			return nil, fmt.Errorf("invalid runtime counter rule %q: the limit must be positive", rule)
+		}
+		parsed = append(parsed, runtimeCounterRule{name: name, limitMB: limitMB})
+	}
+	return parsed, nil
+}
+
+// runtimeCounterTrigger reads the System.Runtime counters of the monitored
+// .NET process and fires when one of them exceeds the limit of its rule.
+type runtimeCounterTrigger struct {
+	rules     []runtimeCounterRule
+	installed bool
+}
+
+func (r *runtimeCounterTrigger) window() time.Duration {
+	return 0
+}
+
+func (r *runtimeCounterTrigger) check(m *containerMonitor, _ memorySample) string {
+	values, err := r.collect(m)
+	if err != nil {
+		m.logf("Error reading runtime counters: %v", err)
+		return ""
+	}
+	for _, rule := range r.rules {
+		value, ok := values[rule.name]
+		if !ok {
+			continue
+		}
+		m.logf("Runtime counter %s: %.2f MB", rule.name, value)
+		if value > rule.limitMB {
+			return fmt.Sprintf("runtime counter %s %.2f MB exceeded %.2f MB", rule.name, value, rule.limitMB)
+		}
+	}
+	return ""
+}
+
+// collect runs dotnet-counters against the monitored process, installing it
+// in the container on first use, and returns the last value in MB of each
+// counter of the rules.
+func (r *runtimeCounterTrigger) collect(m *containerMonitor) (map[string]float64, error) {
+	client, containerName, baseDockerURL := m.settings.client, m.target.Container, m.settings.baseDockerURL
+	if !r.installed {
+		output, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "ls", dotnetCountersPath)
+		if err != nil || strings.Contains(output, "No such file or directory") {
+			m.logf("Installing dotnet-counters...")
+			output, err = helpers.ExecInContainer(client, containerName, baseDockerURL, "sh", "-c", "apt-get update && apt-get install -y curl && curl -sSL https://dot.net/v1/dotnet-install.sh -o dotnet-install.sh && chmod +x dotnet-install.sh && ./dotnet-install.sh --channel 8.0 --install-dir /root/.dotnet && /root/.dotnet/dotnet tool install --global dotnet-counters")
+			if err != nil {
+				return nil, fmt.Errorf("failed to install dotnet-counters: %v, output: %s", err, output)
+			}
+		}
+		r.installed = true
+	}
+
+	pid, err := helpers.GetPIDInContainer(client, containerName, m.target.Process, baseDockerURL)
+	if err != nil {
+		return nil, err
+	}
+	counters := make([]string, 0, len(r.rules))
+	for _, rule := range r.rules {
+		counters = append(counters, runtimeCounters[rule.name].counter)
+	}
+	duration := time.Time{}.Add(runtimeCountersDuration).Format("15:04:05")
+	output, err := helpers.ExecInContainer(client, containerName, baseDockerURL, dotnetCountersPath, "collect",
+		"-p", strconv.Itoa(pid),
+		"--counters", "System.Runtime["+strings.Join(counters, ",")+"]",
+		"--refresh-interval", "1",
+		"--duration", duration,
+		"--format", "json",
+		"-o", runtimeCountersFile)
+	if err != nil {
+		r.installed = false
+		return nil, fmt.Errorf("failed to collect runtime counters: %v, output: %s", err, output)
+	}
+	report, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "cat", runtimeCountersFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read runtime counters: %v", err)
+	}
+	return parseRuntimeCountersReport(helpers.DemuxExecOutput(report))
+}
+
+// parseRuntimeCountersReport returns the last value in MB of each known
+// counter of a dotnet-counters JSON report, e.g.:
+//
+//	{"TargetProcess": "dotnet", "StartTime": "...", "Events": [
+//	{"timestamp": "...", "provider": "System.Runtime", "name": "GC Heap Size (MB)", "tags": "", "counterType": "Metric", "value": 6144.5}]}
+func parseRuntimeCountersReport(report string) (map[string]float64, error) {
+	var parsed struct {
+		Events []struct {
+			Provider string  `json:"provider"`
+			Name     string  `json:"name"`
+			Value    float64 `json:"value"`
+		} `json:"Events"`
+	}
+	report = strings.TrimSpace(report)
+	if err := json.Unmarshal([]byte(report), &parsed); err != nil {
+		// The report is left unterminated when collection is interrupted
+		if err := json.Unmarshal([]byte(strings.TrimRight(report, ", \n")+"]}"), &parsed); err != nil {
+			return nil, fmt.Errorf("failed to parse runtime counters report: %v", err)
+		}
+	}
+
+	values := map[string]float64{}
+	for _, event := range parsed.Events {
+		display, unit, _ := strings.Cut(event.Name, " (")
+		for name, counter := range runtimeCounters {
+			if counter.display != display {
+				continue
+			}
+			switch strings.TrimSuffix(unit, ")") {
+			case "B":
+				values[name] = event.Value / 1024 / 1024
+			default:
+				values[name] = event.Value
+			}
+		}
+	}
+	return values, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+const testRuntimeCountersReport = `{"TargetProcess": "dotnet", "StartTime": "10/16/2026 10:00:00", "Events": [
+{"timestamp": "2026-10-16 10:00:01Z", "provider": "System.Runtime", "name": "GC Heap Size (MB)", "tags": "", "counterType": "Metric", "value": 5120 },
+{"timestamp": "2026-10-16 10:00:01Z", "provider": "System.Runtime", "name": "LOH Size (B)", "tags": "", "counterType": "Metric", "value": 104857600 },
+{"timestamp": "2026-10-16 10:00:02Z", "provider": "System.Runtime", "name": "GC Heap Size (MB)", "tags": "", "counterType": "Metric", "value": 6400 }]}`
+
+func TestParseRuntimeCounterRules(t *testing.T) {
+	rules, err := parseRuntimeCounterRules("gc-heap-size > 6GB, loh-size>500MB")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(rules) != 2 || rules[0] != (runtimeCounterRule{name: "gc-heap-size", limitMB: 6144}) || rules[1] != (runtimeCounterRule{name: "loh-size", limitMB: 500}) {
+		t.Errorf("Unexpected rules: %+v", rules)
+	}
+
+	for _, rule := range []string{"gc-heap-size", "threadpool-queue-length > 5", "gc-heap-size > lots", "gen2-size > 0MB"} {
+		if _, err := parseRuntimeCounterRules(rule); err == nil {
+			t.Errorf("Expected an error for %q", rule)
+		}
+	}
+}
+
+func TestParseRuntimeCountersReport(t *testing.T) {
+	values, err := parseRuntimeCountersReport(testRuntimeCountersReport)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if values["gc-heap-size"] != 6400 || values["loh-size"] != 100 {
+		t.Errorf("Unexpected counter values: %v", values)
+	}
+
+	// An interrupted collection leaves the events array open
+	truncated := strings.TrimSuffix(testRuntimeCountersReport, "]}") + ","
+	values, err = parseRuntimeCountersReport(truncated)
+	if err != nil || values["gc-heap-size"] != 6400 {
+		t.Errorf("Unexpected counter values for a truncated report: %v (%v)", values, err)
+	}
+}
+
+func TestRuntimeCounterTrigger(t *testing.T) {
+	var commands []string
+	originalExecInContainer := helpers.ExecInContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		commands = append(commands, strings.Join(command, " "))
+		switch command[0] {
+		case "ls":
+			return dotnetCountersPath, nil
+		case "cat":
+			// Docker splits long output in several frames
+			half := len(testRuntimeCountersReport) / 2
+			return execFrame(testRuntimeCountersReport[:half]) + execFrame(testRuntimeCountersReport[half:]), nil
+		case dotnetCountersPath:
+			return "", nil
+		}
+		return "root      1234     1  0 10:00 ?        00:00:01 dotnet nethermind.dll", nil
+	}
+	defer func() { helpers.ExecInContainer = originalExecInContainer }()
+
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "dotnet-dump", DumpsCount: 1, RuntimeCounters: "gc-heap-size > 6GB"}
+	m, err := newContainerMonitor(monitorSettings{}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if reason := m.triggers[0].check(m, memorySample{}); reason == "" {
+		t.Error("Expected the runtime counter trigger to fire")
+	}
+	collect := dotnetCountersPath + " collect -p 1234 --counters System.Runtime[gc-heap-size] --refresh-interval 1 --duration 00:00:05 --format json -o " + runtimeCountersFile
+	found := false
+	for _, command := range commands {
+		found = found || command == collect
+	}
+	if !found {
+		t.Errorf("Expected %q to be executed, got %v", collect, commands)
+	}
+
+	target.DumpTool = "procdump"
+	if _, err := newContainerMonitor(monitorSettings{}, target); err == nil {
+		t.Error("Expected an error for runtime counters with procdump")
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// s3Config describes the S3-compatible bucket dumps are uploaded to.
+type s3Config struct {
+	// endpoint is the base URL of the service, e.g. https://s3.eu-west-1.amazonaws.com
+	// or http://minio:9000
+	endpoint     string
+	region       string
+	bucket       string
+	prefix       string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	// pathStyle addresses the bucket in the path instead of the host name,
+	// as MinIO and most self-hosted services expect
+	pathStyle bool
+	// partSize is the size of the parts of multipart uploads, files up to
+	// this size are uploaded with a single request
+	partSize int64
+}
+
+// s3Uploader uploads files to an S3-compatible bucket with AWS Signature
+// Version 4 signed requests.
+type s3Uploader struct {
+	config s3Config
+	client *http.Client
+	now    func() time.Time
+}
+
+func newS3Uploader(config s3Config) (*s3Uploader, error) {
+	if config.bucket == "" {
+		return nil, fmt.Errorf("no S3 bucket set")
+	}
+	if config.accessKey == "" || config.secretKey == "" {
+		return nil, fmt.Errorf("no S3 credentials set")
+	}
+	if config.region == "" {
+		config.region = "us-east-1"
+	}
+	if config.endpoint == "" {
+		config.endpoint = "https://s3." + config.region + ".amazonaws.com"
+	}
+	if _, err := url.Parse(config.endpoint); err != nil {
+		return nil, fmt.Errorf("invalid S3 endpoint %q: %v", config.endpoint, err)
+	}
+	// S3 requires parts of at least 5 MB, except for the last one
+	if config.partSize < 5*1024*1024 {
+		return nil, fmt.Errorf("S3 part size must be at least 5MB")
+	}
+	return &s3Uploader{config: config, client: &http.Client{}, now: time.Now}, nil
+}
+
+func (u *s3Uploader) Name() string {
+	return "s3://" + path.Join(u.config.bucket, u.config.prefix)
+}
+
+// Store uploads file under the prefix, with its checksum in the sha256
+// metadata of the object.
+func (u *s3Uploader) Store(file, key, sha256sum string) (string, error) {
+	key = path.Join(u.config.prefix, key)
+	var metadata map[string]string
+	if sha256sum != "" {
+		metadata = map[string]string{"sha256": sha256sum}
+	}
+	if err := u.upload(file, key, metadata); err != nil {
+		return "", err
+	}
+	return "s3://" + u.config.bucket + "/" + key, nil
+}
+
+// objectURL returns the URL of key, in path or virtual-hosted style.
+func (u *s3Uploader) objectURL(key string, query url.Values) string {
+	endpoint, _ := url.Parse(u.config.endpoint)
+	objectPath := "/" + key
+	if u.config.pathStyle {
+		objectPath = "/" + u.config.bucket + objectPath
+	} else {
+		endpoint.Host = u.config.bucket + "." + endpoint.Host
+	}
+	endpoint.Path = objectPath
+	endpoint.RawPath = uriEncode(objectPath, false)
+	endpoint.RawQuery = canonicalQuery(query)
+	return endpoint.String()
+}
+
+// upload uploads file to key with the given x-amz-meta-* metadata, in parts
+// when it is larger than the part size, and verifies the size of the stored
+// object. Every request carries the Content-MD5 of its body, so the service
+// rejects a body corrupted in transit, and the uploaded content is checked
+// against the sha256 metadata before the upload completes.
+func (u *s3Uploader) upload(file, key string, metadata map[string]string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", file, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", file, err)
+	}
+
+	if info.Size() <= u.config.partSize {
+		body, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", file, err)
+		}
+		sum := sha256.Sum256(body)
+		if err := checkSHA256(file, sum[:], metadata["sha256"]); err != nil {
+			return err
+		}
+		if _, err := u.do(http.MethodPut, key, nil, body, metadata); err != nil {
+			return err
+		}
+	} else if err := u.uploadMultipart(f, key, metadata); err != nil {
+		return err
+	}
+	return u.verify(key, info.Size(), metadata["sha256"])
+}
+
+type s3CompletedPart struct {
+	PartNumber int    `xml:"PartNumber"`
+	ETag       string `xml:"ETag"`
+}
+
+// uploadMultipart uploads r in parts of the configured size, aborting the
+// upload on failure so no orphaned parts are left in the bucket.
+func (u *s3Uploader) uploadMultipart(r io.Reader, key string, metadata map[string]string) error {
+	resp, err := u.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, metadata)
+	if err != nil {
+		return err
+	}
+	var initiate struct {
+		UploadID string `xml:"UploadId"`
+	}
+	if err := xml.Unmarshal(resp.body, &initiate); err != nil || initiate.UploadID == "" {
+		return fmt.Errorf("failed to initiate multipart upload of %s: %v", key, err)
+	}
+
+	var parts []s3CompletedPart
+	hash := sha256.New()
+	err = func() error {
+		buf := make([]byte, u.config.partSize)
+		for number := 1; ; number++ {
+			n, err := io.ReadFull(r, buf)
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil && err != io.ErrUnexpectedEOF {
+				return fmt.Errorf("failed to read part %d: %v", number, err)
+			}
+			hash.Write(buf[:n])
+			query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiate.UploadID}}
+			resp, err := u.do(http.MethodPut, key, query, buf[:n], nil)
+			if err != nil {
+				return err
+			}
+			parts = append(parts, s3CompletedPart{PartNumber: number, ETag: resp.header.Get("ETag")})
+			if n < len(buf) {
+				return nil
+			}
+		}
+	}()
+	if err == nil {
+		err = checkSHA256(key, hash.Sum(nil), metadata["sha256"])
+	}
+	if err == nil {
+		var complete []byte
+		complete, err = xml.Marshal(struct {
+			XMLName xml.Name          `xml:"CompleteMultipartUpload"`
+			Parts   []s3CompletedPart `xml:"Part"`
+		}{Parts: parts})
+		if err == nil {
+			_, err = u.do(http.MethodPost, key, url.Values{"uploadId": {initiate.UploadID}}, complete, nil)
+		}
+	}
+	if err != nil {
+		if _, abortErr := u.do(http.MethodDelete, key, url.Values{"uploadId": {initiate.UploadID}}, nil, nil); abortErr != nil {
+			fmt.Printf("Failed to abort multipart upload of %s: %v\n", key, abortErr)
+		}
+		return fmt.Errorf("multipart upload of %s failed: %v", key, err)
+	}
+	return nil
+}
+
+// verify checks that the stored object has the expected size and, when set,
+// the expected sha256 metadata.
+func (u *s3Uploader) verify(key string, size int64, sha256sum string) error {
+	resp, err := u.do(http.MethodHead, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to verify upload of %s: %v", key, err)
+	}
+	if length := resp.header.Get("Content-Length"); length != strconv.FormatInt(size, 10) {
+		return fmt.Errorf("uploaded object %s has %s bytes, expected %d", key, length, size)
+	}
+	if stored := resp.header.Get("X-Amz-Meta-Sha256"); sha256sum != "" && stored != sha256sum {
+		return fmt.Errorf("uploaded object %s has sha256 %q, expected %s", key, stored, sha256sum)
+	}
+	return nil
+}
+
+// checkSHA256 compares the SHA-256 of the uploaded content of name with the
+// expected checksum, when set.
+func checkSHA256(name string, sum []byte, expected string) error {
+	if actual := hex.EncodeToString(sum); expected != "" && actual != expected {
+		return fmt.Errorf("content of %s changed before the upload: sha256 %s, expected %s", name, actual, expected)
+	}
+	return nil
+}
+
+type s3Response struct {
+	header http.Header
+	body   []byte
+}
+
+// do sends a signed request for key and returns the response of a successful
+// request.
+func (u *s3Uploader) do(method, key string, query url.Values, body []byte, metadata map[string]string) (*s3Response, error) {
+	req, err := http.NewRequest(method, u.objectURL(key, query), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	if method == http.MethodPut {
+		sum := md5.Sum(body)
+		req.Header.Set("Content-Md5", base64.StdEncoding.EncodeToString(sum[:]))
+	}
+	for name, value := range metadata {
+		req.Header.Set("X-Amz-Meta-"+name, value)
+	}
+	u.sign(req, body)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %v", method, key, err)
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %v", method, key, err)
+	}
+	// CompleteMultipartUpload reports errors with a 200 status
+	if resp.StatusCode/100 != 2 || bytes.Contains(respBody, []byte("<Error>")) {
+		return nil, fmt.Errorf("%s %s failed: HTTP status %d: %s", method, key, resp.StatusCode, respBody)
+	}
+	return &s3Response{header: resp.Header, body: respBody}, nil
+}
+
+// sign adds the AWS Signature Version 4 headers to req, signing the host and
+// every header already set.
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func (u *s3Uploader) sign(req *http.Request, body []byte) {
+	now := u.now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	payloadHash := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if u.config.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", u.config.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := now.Format("20060102") + "/" + u.config.region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+u.config.secretKey), now.Format("20060102"))
+	key = hmacSHA256(key, u.config.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", u.config.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQuery encodes query sorted by key, with RFC 3986 escaping.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode escapes s as SigV4 expects, leaving "/" alone unless encodeSlash.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// dumpSeries takes a baseline dump when a trigger fires, then follow-up dumps
+// at fixed memory increments and/or time offsets from the baseline, so the
+// dumps of one incident can be diffed against each other. All the dumps of a
+// series share its ID.
+type dumpSeries struct {
+	stepMB   float64
+	interval time.Duration
+
+	id           string
+	index        int
+	baselineMB   float64
+	baselineTime time.Time
+}
+
+func newDumpSeries(step, interval string) (*dumpSeries, error) {
+	if step == "" && interval == "" {
+		return nil, nil
+	}
+	series := &dumpSeries{}
+	if step != "" {
+		stepMB, err := parseSizeMB(step)
+		if err != nil {
+			return nil, fmt.Errorf("invalid series step: %v", err)
+		}
+		if stepMB <= 0 {
+			return nil, fmt.Errorf("invalid series step %q: must be positive", step)
+		}
+		series.stepMB = stepMB
+	}
+	if interval != "" {
+		duration, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid series interval: %v", err)
+		}
+		if duration <= 0 {
+			return nil, fmt.Errorf("invalid series interval %q: must be positive", interval)
+		}
+		series.interval = duration
+	}
+	return series, nil
+}
+
+// started reports whether the baseline dump has been taken.
+func (s *dumpSeries) started() bool {
+	return s.index > 0
+}
+
+// begin assigns the series ID before the baseline dump.
+func (s *dumpSeries) begin() {
+	if s.id != "" {
+		return
+	}
+	b := make([]byte, 4)
+	rand.Read(b)
+	s.id = hex.EncodeToString(b)
+}
+
+// record accounts for a successful dump of the series.
+func (s *dumpSeries) record(usageMB float64, t time.Time) {
+	if s.index == 0 {
+		s.baselineMB = usageMB
+		s.baselineTime = t
+	}
+	s.index++
+}
+
+// next returns the reason to take the next follow-up dump, or an empty string.
+func (s *dumpSeries) next(now memorySample) string {
+	if s.stepMB > 0 {
+		targetMB := s.baselineMB + float64(s.index)*s.stepMB
+		if now.usageMB >= targetMB {
+			return fmt.Sprintf("series %s follow-up %d: memory reached %.0f MB (baseline %.0f MB + %d x %.0f MB)", s.id, s.index, now.usageMB, s.baselineMB, s.index, s.stepMB)
+		}
+	}
+	if s.interval > 0 {
+		offset := time.Duration(s.index) * s.interval
+		if now.time.Sub(s.baselineTime) >= offset {
+			return fmt.Sprintf("series %s follow-up %d: %v since the baseline dump", s.id, s.index, offset)
+		}
+	}
+	return ""
+}
+
+// tag returns the file name suffix identifying the dump in the series.
+func (s *dumpSeries) tag() string {
+	return fmt.Sprintf("series-%s-%d", s.id, s.index)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func TestNewDumpSeries(t *testing.T) {
+	series, err := newDumpSeries("", "")
+	if err != nil || series != nil {
+		t.Errorf("Expected no series without step and interval, got %+v (%v)", series, err)
+	}
+
+	series, err = newDumpSeries("500MB", "10m")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if series.stepMB != 500 || series.interval != 10*time.Minute {
+		t.Errorf("Unexpected series: %+v", series)
+	}
+
+	if _, err := newDumpSeries("0MB", ""); err == nil {
+		t.Error("Expected an error for a zero step")
+	}
+	if _, err := newDumpSeries("", "later"); err == nil {
+		t.Error("Expected an error for an invalid interval")
+	}
+}
+
+func TestDumpSeriesFollowUps(t *testing.T) {
+	series, _ := newDumpSeries("500MB", "30m")
+	start := time.Unix(0, 0)
+
+	series.begin()
+	if series.id == "" || series.started() {
+		t.Fatalf("Expected an ID and no baseline yet, got %+v", series)
+	}
+	id := series.id
+	series.record(2000, start)
+	if !strings.HasPrefix(series.tag(), "series-"+id+"-1") {
+		t.Errorf("Unexpected tag: %s", series.tag())
+	}
+
+	if reason := series.next(memorySample{time: start.Add(time.Minute), usageMB: 2300}); reason != "" {
+		t.Errorf("Expected no follow-up yet, got %q", reason)
+	}
+	if reason := series.next(memorySample{time: start.Add(2 * time.Minute), usageMB: 2500}); reason == "" {
+		t.Error("Expected a follow-up at the memory step")
+	}
+	series.record(2500, start.Add(2*time.Minute))
+
+	// Second follow-up is due at +1000 MB or 60 minutes after the baseline
+	if reason := series.next(memorySample{time: start.Add(59 * time.Minute), usageMB: 2600}); reason != "" {
+		t.Errorf("Expected no follow-up yet, got %q", reason)
+	}
+	if reason := series.next(memorySample{time: start.Add(60 * time.Minute), usageMB: 2600}); reason == "" {
+		t.Error("Expected a follow-up at the time offset")
+	}
+	if series.id != id {
+		t.Errorf("Expected the series ID to stay %s, got %s", id, series.id)
+	}
+}
+
+func TestSeriesStopsWithoutMonitor(t *testing.T) {
+	originalGetContainerMemoryUsage := helpers.GetContainerMemoryUsage
+	helpers.GetContainerMemoryUsage = func(client *http.Client, containerName, baseDockerURL string, getTotalMemory bool) (float64, uint64, error) {
+		return 50.0, 4096, nil
+	}
+	defer func() { helpers.GetContainerMemoryUsage = originalGetContainerMemoryUsage }()
+
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 3}
+	m, err := newContainerMonitor(monitorSettings{checkInterval: time.Hour}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// The baseline is taken, the next follow-up is due at 2500 MB
+	m.series = &dumpSeries{stepMB: 500, id: "0123abcd", index: 1, baselineMB: 2000, baselineTime: time.Now()}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	m.run(ctx)
+	if ctx.Err() != nil {
+		t.Error("Expected the monitor to stop after the baseline without -monitor")
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// sftpSink uploads dumps to a directory of an SFTP server, authenticating
+// with the password of the URL or the -sftp-key private key.
+type sftpSink struct {
+	address string
+	// server is user@host[:port] as given in the sink URL
+	server string
+	dir    string
+	config *ssh.ClientConfig
+}
+
+func newSFTPSink(u *url.URL, options sinkOptions) (*sftpSink, error) {
+	if u.User == nil || u.User.Username() == "" {
+		return nil, fmt.Errorf("no user in SFTP sink %s, expected sftp://user@host/dir", u.Redacted())
+	}
+	config := &ssh.ClientConfig{User: u.User.Username(), Timeout: 30 * time.Second}
+	if password, ok := u.User.Password(); ok {
+		config.Auth = append(config.Auth, ssh.Password(password))
+	}
+	if options.sftpKey != "" {
+		key, err := os.ReadFile(options.sftpKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read SFTP key: %v", err)
+		}
+		signer, err := ssh.ParsePrivateKey(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse SFTP key %s: %v", options.sftpKey, err)
+		}
+		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
+	}
+	if len(config.Auth) == 0 {
+		return nil, fmt.Errorf("no SFTP credentials set, add a password to the sink URL or set -sftp-key")
+	}
+	if options.sftpInsecure {
+		config.HostKeyCallback = ssh.InsecureIgnoreHostKey()
+	} else {
+		callback, err := knownhosts.New(options.sftpKnownHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load SFTP known hosts: %v", err)
+		}
+		config.HostKeyCallback = callback
+	}
+
+	address := u.Host
+	if u.Port() == "" {
+		address = net.JoinHostPort(u.Hostname(), "22")
+	}
+	dir := u.Path
+	if dir == "" {
+		dir = "."
+	}
+	server := u.User.Username() + "@" + u.Host
+	return &sftpSink{address: address, server: server, dir: dir, config: config}, nil
+}
+
+func (s *sftpSink) Name() string {
+	return "sftp://" + s.server + "/" + strings.TrimPrefix(s.dir, "/")
+}
+
+func (s *sftpSink) Store(file, key, _ string) (string, error) {
+	conn, err := ssh.Dial("tcp", s.address, s.config)
+	if err != nil {
+		return "", fmt.Errorf("failed to connect to %s: %v", s.address, err)
+	}
+	defer conn.Close()
+	// Concurrent writes keep the upload from being bound by the round trip time
+	client, err := sftp.NewClient(conn, sftp.UseConcurrentWrites(true))
+	if err != nil {
+		return "", fmt.Errorf("failed to start SFTP session: %v", err)
+	}
+	defer client.Close()
+
+	remotePath := path.Join(s.dir, key)
+	if err := sftpUpload(client, file, remotePath); err != nil {
+		return "", err
+	}
+	return "sftp://" + s.server + "/" + strings.TrimPrefix(remotePath, "/"), nil
+}
+
+// sftpUpload writes the local file to remotePath through a temporary file, and
+// renames it once its size is checked.
+func sftpUpload(client *sftp.Client, file, remotePath string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %v", file, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %v", file, err)
+	}
+
+	if err := client.MkdirAll(path.Dir(remotePath)); err != nil {
+		return fmt.Errorf("failed to create %s: %v", path.Dir(remotePath), err)
+	}
+	tmpPath := remotePath + ".part"
+	out, err := client.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %v", tmpPath, err)
+	}
+	_, err = out.ReadFrom(f)
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		client.Remove(tmpPath)
+		return fmt.Errorf("failed to write %s: %v", tmpPath, err)
+	}
+	remote, err := client.Stat(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to verify %s: %v", remotePath, err)
+	}
+	if remote.Size() != info.Size() {
+		client.Remove(tmpPath)
+		return fmt.Errorf("uploaded file %s has %d bytes, expected %d", remotePath, remote.Size(), info.Size())
+	}
+	// Plain SFTP renames fail when the target exists
+	client.Remove(remotePath)
+	if err := client.Rename(tmpPath, remotePath); err != nil {
+		return fmt.Errorf("failed to rename %s: %v", remotePath, err)
+	}
+	return nil
+}
+
+// defaultKnownHosts returns the known_hosts file of the current user.
+func defaultKnownHosts() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
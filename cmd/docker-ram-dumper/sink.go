@@ -0,0 +1,242 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Sink is implemented by every place dumps saved to the host dump directory
+// can be stored in.
+type Sink interface {
+	// Name identifies the sink in logs and manifests.
+	Name() string
+	// Store copies the local file to key, a slash separated relative path
+	// such as <host>/<container>/<file>, and returns where it was stored.
+	// sha256sum is the checksum of the file when known, sinks that can
+	// verify the stored copy against it do so.
+	Store(file, key, sha256sum string) (string, error)
+}
+
+// sinkResult records whether a dump was stored in a sink.
+type sinkResult struct {
+	Sink     string `json:"sink"`
+	Location string `json:"location,omitempty"`
+	Stored   bool   `json:"stored"`
+	Error    string `json:"error,omitempty"`
+}
+
+// sinkOptions holds the settings of the sinks that cannot be expressed in
+// their -sink URL.
+type sinkOptions struct {
+	sftpKey        string
+	sftpKnownHosts string
+	sftpInsecure   bool
+	httpMethod     string
+	httpHeaders    []string
+}
+
+// listFlag collects the values of a flag that can be repeated.
+type listFlag []string
+
+func (l *listFlag) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *listFlag) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+// newSink returns the sink of a -sink value: a local directory given as a
+// path or a file:// URL, an sftp://user@host/dir URL or an http(s):// URL.
+func newSink(spec string, options sinkOptions) (Sink, error) {
+	if !strings.Contains(spec, "://") {
+		return newDirSink(spec)
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sink %q: %v", spec, err)
+	}
+	switch u.Scheme {
+	case "file":
+		return newDirSink(u.Path)
+	case "sftp":
+		return newSFTPSink(u, options)
+	case "http", "https":
+		return newHTTPSink(u, options)
+	default:
+		return nil, fmt.Errorf("unsupported sink %q, expected a directory, sftp://, http:// or https:// URL", spec)
+	}
+}
+
+// dirSink copies dumps to a local directory, e.g. a network share mounted on
+// the host.
+type dirSink struct {
+	dir string
+}
+
+func newDirSink(dir string) (*dirSink, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("no sink directory set")
+	}
+	return &dirSink{dir: filepath.Clean(dir)}, nil
+}
+
+func (s *dirSink) Name() string {
+	return s.dir
+}
+
+func (s *dirSink) Store(file, key, _ string) (string, error) {
+	dst := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return "", fmt.Errorf("failed to create sink directory: %v", err)
+	}
+	src, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", file, err)
+	}
+	defer src.Close()
+
+	out, err := os.Create(dst + ".part")
+	if err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", dst, err)
+	}
+	_, err = io.Copy(out, src)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(dst + ".part")
+		return "", fmt.Errorf("failed to copy %s to %s: %v", file, dst, err)
+	}
+	return dst, os.Rename(dst+".part", dst)
+}
+
+// httpSink sends dumps to an HTTP endpoint. With PUT each file is sent to
+// <url>/<key>, with POST all files are sent to the URL with their key in the
+// X-Dump-Key header.
+type httpSink struct {
+	url     *url.URL
+	method  string
+	headers http.Header
+	client  *http.Client
+}
+
+func newHTTPSink(u *url.URL, options sinkOptions) (*httpSink, error) {
+	method := strings.ToUpper(options.httpMethod)
+	if method == "" {
+		method = http.MethodPut
+	}
+	if method != http.MethodPut && method != http.MethodPost {
+		return nil, fmt.Errorf("unsupported HTTP sink method: %s (supported: PUT, POST)", options.httpMethod)
+	}
+	headers := http.Header{}
+	for _, header := range options.httpHeaders {
+		name, value, ok := strings.Cut(header, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid HTTP sink header %q, expected <name>: <value>", header)
+		}
+		headers.Add(strings.TrimSpace(name), strings.TrimSpace(value))
+	}
+	return &httpSink{url: u, method: method, headers: headers, client: &http.Client{}}, nil
+}
+
+func (s *httpSink) Name() string {
+	return s.method + " " + s.url.Redacted()
+}
+
+func (s *httpSink) Store(file, key, sha256sum string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", file, err)
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("failed to stat %s: %v", file, err)
+	}
+
+	target := *s.url
+	if s.method == http.MethodPut {
+		target = *target.JoinPath(strings.Split(key, "/")...)
+	}
+	req, err := http.NewRequest(s.method, target.String(), f)
+	if err != nil {
+		return "", err
+	}
+	req.ContentLength = info.Size()
+	req.Header = s.headers.Clone()
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Dump-Key", key)
+	if sha256sum != "" {
+		req.Header.Set("X-Checksum-Sha256", sha256sum)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("%s %s failed: %v", s.method, target.Redacted(), err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("%s %s failed: HTTP status %d: %s", s.method, target.Redacted(), resp.StatusCode, body)
+	}
+	if location := resp.Header.Get("Location"); location != "" {
+		return location, nil
+	}
+	return target.Redacted(), nil
+}
+
+// storeDump stores a saved dump in every sink and records the outcome of
+// each in the manifest. A sink failing does not stop the others.
+func (m *containerMonitor) storeDump(manifest *dumpManifest) {
+	manifest.Sinks = nil
+	key := sinkKey(*manifest, manifest.File)
+	for _, sink := range m.settings.sinks {
+		m.logf("Storing %s in %s ...", manifest.File, sink.Name())
+		start := time.Now()
+		location, err := sink.Store(manifest.File, key, manifest.SHA256)
+		result := sinkResult{Sink: sink.Name(), Location: location, Stored: err == nil}
+		if err != nil {
+			result.Error = err.Error()
+			m.logf("Error storing dump in %s: %v", sink.Name(), err)
+		} else {
+			m.logf("Stored dump in %s in %v", location, time.Since(start).Round(time.Second))
+		}
+		manifest.Sinks = append(manifest.Sinks, result)
+	}
+}
+
+// storeManifest stores the manifest of a dump in the sinks the dump was
+// stored in. It reports whether the dump and its manifest are in every sink.
+func (m *containerMonitor) storeManifest(manifest dumpManifest) bool {
+	stored := true
+	file := manifest.File + manifestExtension
+	key := sinkKey(manifest, file)
+	for i, sink := range m.settings.sinks {
+		if !manifest.Sinks[i].Stored {
+			stored = false
+			continue
+		}
+		if _, err := sink.Store(file, key, ""); err != nil {
+			m.logf("Error storing dump manifest in %s: %v", sink.Name(), err)
+			stored = false
+		}
+	}
+	return stored
+}
+
+// sinkKey returns the key of a file of a dump in the sinks.
+func sinkKey(manifest dumpManifest, file string) string {
+	return path.Join(manifest.HostName, manifest.Container, filepath.Base(file))
+}
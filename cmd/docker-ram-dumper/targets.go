@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// targetConfig describes a container to monitor. Fields left empty in the
+// config file are taken from the command line flags.
+type targetConfig struct {
+	Container  string `json:"container"`
+	Threshold  string `json:"threshold"`
+	Process    string `json:"process"`
+	DumpTool   string `json:"dump_tool"`
+	DumpType   string `json:"dump_type"`
+	DumpsCount int    `json:"dumps_count"`
+	Growth     string `json:"growth"`
+	OOMHorizon string `json:"oom_horizon"`
+
+	SeriesStep     string `json:"series_step"`
+	SeriesInterval string `json:"series_interval"`
+
+	Cooldown string `json:"cooldown"`
+	Rearm    string `json:"rearm"`
+
+	RuntimeCounters string `json:"runtime_counters"`
+}
+
+// targetsFile is the format of the file passed with -config.
+type targetsFile struct {
+	Targets []targetConfig `json:"targets"`
+}
+
+// targetsFromFlags creates a target for each name of the comma separated
+// -container flag, all sharing the defaults from the other flags.
+func targetsFromFlags(containers string, defaults targetConfig) []targetConfig {
+	var targets []targetConfig
+	for _, name := range splitList(containers) {
+		target := defaults
+		target.Container = name
+		targets = append(targets, target)
+	}
+	return targets
+}
+
+// loadTargetsFile reads the targets from a JSON config file, e.g.:
+//
+//	{"targets": [{"container": "sedge-node", "threshold": "85%", "process": "nethermind", "dump_tool": "dotnet-dump", "dumps_count": 2}]}
+func loadTargetsFile(path string, defaults targetConfig) ([]targetConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read config file: %v", err)
+	}
+	var file targetsFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	if len(file.Targets) == 0 {
+		return nil, fmt.Errorf("no targets found in config file %s", path)
+	}
+
+	targets := make([]targetConfig, 0, len(file.Targets))
+	for i, target := range file.Targets {
+		if target.Container == "" {
+			return nil, fmt.Errorf("target %d in config file %s has no container", i, path)
+		}
+		targets = append(targets, target.withDefaults(defaults))
+	}
+	return targets, nil
+}
+
+func (t targetConfig) withDefaults(defaults targetConfig) targetConfig {
+	if t.Threshold == "" {
+		t.Threshold = defaults.Threshold
+	}
+	if t.Process == "" {
+		t.Process = defaults.Process
+	}
+	if t.DumpTool == "" {
+		t.DumpTool = defaults.DumpTool
+	}
+	if t.DumpType == "" {
+		t.DumpType = defaults.DumpType
+	}
+	if t.DumpsCount == 0 {
+		t.DumpsCount = defaults.DumpsCount
+	}
+	if t.Growth == "" {
+		t.Growth = defaults.Growth
+	}
+	if t.OOMHorizon == "" {
+		t.OOMHorizon = defaults.OOMHorizon
+	}
+	if t.SeriesStep == "" {
+		t.SeriesStep = defaults.SeriesStep
+	}
+	if t.SeriesInterval == "" {
+		t.SeriesInterval = defaults.SeriesInterval
+	}
+	if t.Cooldown == "" {
+		t.Cooldown = defaults.Cooldown
+	}
+	if t.Rearm == "" {
+		t.Rearm = defaults.Rearm
+	}
+	if t.RuntimeCounters == "" {
+		t.RuntimeCounters = defaults.RuntimeCounters
+	}
+	return t
+}
+
+// splitList splits a comma separated flag value, dropping empty items.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseThreshold parses a threshold such as "90%" or "1000MB". Values without
+// a unit are treated as percentages.
+func parseThreshold(threshold string) (float64, bool, error) {
+	isPercentage := !strings.HasSuffix(strings.ToLower(threshold), "mb")
+	thresholdStr := strings.TrimSuffix(strings.ToLower(threshold), "%")
+	thresholdStr = strings.TrimSuffix(thresholdStr, "mb")
+	value, err := strconv.ParseFloat(strings.TrimSpace(thresholdStr), 64)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid threshold %q: %v", threshold, err)
+	}
+	return value, isPercentage, nil
+}
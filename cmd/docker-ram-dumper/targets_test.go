@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testTargetDefaults = targetConfig{
+	Threshold:  "90%",
+	Process:    "dotnet",
+	DumpTool:   "procdump",
+	DumpsCount: 1,
+}
+
+func TestTargetsFromFlags(t *testing.T) {
+	targets := targetsFromFlags("node-a, node-b,", testTargetDefaults)
+
+	expected := []targetConfig{
+		{Container: "node-a", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1},
+		{Container: "node-b", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Unexpected targets: got %+v, want %+v", targets, expected)
+	}
+}
+
+func TestLoadTargetsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "targets.json")
+	config := `{"targets": [
+		{"container": "sedge-node", "threshold": "85%", "process": "nethermind", "dump_tool": "dotnet-dump", "dumps_count": 2},
+		{"container": "indexer", "dump_tool": "jcmd"}
+	]}`
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	targets, err := loadTargetsFile(path, testTargetDefaults)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := []targetConfig{
+		{Container: "sedge-node", Threshold: "85%", Process: "nethermind", DumpTool: "dotnet-dump", DumpsCount: 2},
+		{Container: "indexer", Threshold: "90%", Process: "dotnet", DumpTool: "jcmd", DumpsCount: 1},
+	}
+	if !reflect.DeepEqual(targets, expected) {
+		t.Errorf("Unexpected targets: got %+v, want %+v", targets, expected)
+	}
+}
+
+func TestParseThreshold(t *testing.T) {
+	tests := []struct {
+		threshold    string
+		value        float64
+		isPercentage bool
+	}{
+		{"90%", 90, true},
+		{"85", 85, true},
+		{"1000MB", 1000, false},
+		{"512mb", 512, false},
+	}
+
+	for _, tt := range tests {
+		value, isPercentage, err := parseThreshold(tt.threshold)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tt.threshold, err)
+		}
+		if value != tt.value || isPercentage != tt.isPercentage {
+			t.Errorf("%s: got (%v, %v), want (%v, %v)", tt.threshold, value, isPercentage, tt.value, tt.isPercentage)
+		}
+	}
+
+	if _, _, err := parseThreshold("lots"); err == nil {
+		t.Error("Expected an error for an invalid threshold")
+	}
+}
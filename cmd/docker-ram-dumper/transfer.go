@@ -0,0 +1,252 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+// copyBlockSize is the dd block size used to cut chunks out of a dump, chunk
+// sizes are rounded to it.
+const copyBlockSize = 1024 * 1024
+
+// copyRetryDelay is the pause before a failed chunk is copied again.
+var copyRetryDelay = 5 * time.Second
+
+var sha256Pattern = regexp.MustCompile(`\b[0-9a-f]{64}\b`)
+
+// chunkedCopy copies a dump out of a container in chunks that are each
+// checked against their checksum in the container, so a broken transfer is
+// retried from the last good chunk instead of from the start.
+type chunkedCopy struct {
+	m *containerMonitor
+	// chunkSize is a multiple of copyBlockSize
+	chunkSize int64
+	retries   int
+}
+
+// copyFromContainer copies srcPath out of the container to dstPath on the
+// host, compressed with the configured compression. Once every chunk is
+// copied, the SHA-256 of the copied content is compared with sha256sum of the
+// file in the container.
+func (m *containerMonitor) copyFromContainer(srcPath, dstPath string) error {
+	c := chunkedCopy{m: m, chunkSize: m.copyChunkSize(), retries: m.settings.copyRetries}
+	return c.copy(srcPath, dstPath)
+}
+
+// copyChunkSize returns the configured chunk size rounded to copyBlockSize.
+func (m *containerMonitor) copyChunkSize() int64 {
+	chunkSize := max(m.settings.copyChunkSize, copyBlockSize)
+	return chunkSize - chunkSize%copyBlockSize
+}
+
+func (c chunkedCopy) copy(srcPath, dstPath string) error {
+	size, err := c.fileSize(srcPath)
+	if err != nil {
+		return err
+	}
+	expected, err := c.fileSHA256(srcPath)
+	if err != nil {
+		return err
+	}
+
+	tmpPath := dstPath + ".part"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create destination file: %v", err)
+	}
+	var w io.Writer = out
+	compressor, err := c.m.settings.compression.NewWriter(out)
+	if err != nil {
+		out.Close()
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to create compressor: %v", err)
+	}
+	if compressor != nil {
+		w = compressor
+	}
+	hash := sha256.New()
+
+	err = func() error {
+		chunks := (size + c.chunkSize - 1) / c.chunkSize
+		for index := int64(0); index < max(chunks, 1); index++ {
+			offset := index * c.chunkSize
+			length := min(c.chunkSize, size-offset)
+			var chunk, containerChunk string
+			var err error
+			for attempt := 0; attempt <= c.retries; attempt++ {
+				if attempt > 0 {
+					c.m.logf("Retrying chunk %d/%d of %s from offset %d (attempt %d of %d): %v", index+1, chunks, srcPath, offset, attempt+1, c.retries+1, err)
+					time.Sleep(copyRetryDelay)
+				}
+				chunk, containerChunk, err = c.copyChunk(srcPath, dstPath, offset, length, size, expected)
+				if err == nil {
+					break
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("failed to copy %s at offset %d after %d attempts: %v", srcPath, offset, c.retries+1, err)
+			}
+			// Only verified chunks reach the destination file. The chunk in
+			// the container is removed only then, as it is the host chunk
+			// itself when both dump directories are the same bind mount.
+			err = appendChunk(chunk, io.MultiWriter(w, hash))
+			os.Remove(chunk)
+			c.removeContainerChunk(containerChunk)
+			if err != nil {
+				return err
+			}
+		}
+		if compressor != nil {
+			return compressor.Close()
+		}
+		return nil
+	}()
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+			err = fmt.Errorf("checksum mismatch for %s: sha256 %s in the container, %s on the host", srcPath, expected, actual)
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to move file into place: %v", err)
+	}
+	c.m.logf("Verified %s against the file in the container (sha256 %s)", dstPath, expected)
+	return nil
+}
+
+// copyChunk copies length bytes of srcPath at offset to a chunk file on the
+// host and checks its size and checksum. A dump that fits in a single chunk
+// is copied as is, larger ones are cut in the container with dd first. It
+// returns the path of the chunk on the host and of the chunk cut in the
+// container, if any, which the caller removes once the chunk is used.
+func (c chunkedCopy) copyChunk(srcPath, dstPath string, offset, length, size int64, fileSHA256 string) (hostChunk, containerChunk string, err error) {
+	client, containerName, baseDockerURL := c.m.settings.client, c.m.target.Container, c.m.settings.baseDockerURL
+	chunkPath, expected := srcPath, fileSHA256
+	if length != size {
+		chunkPath = srcPath + ".chunk"
+		defer func() {
+			if err != nil {
+				c.removeContainerChunk(chunkPath)
+			}
+		}()
+		output, err := helpers.ExecInContainer(client, containerName, baseDockerURL, "dd",
+			"if="+srcPath,
+			"of="+chunkPath,
+			"bs="+strconv.Itoa(copyBlockSize),
+			"skip="+strconv.FormatInt(offset/copyBlockSize, 10),
+			"count="+strconv.FormatInt(c.chunkSize/copyBlockSize, 10))
+		if err != nil {
+			return "", "", fmt.Errorf("failed to cut chunk: %v, output: %s", err, helpers.DemuxExecOutput(output))
+		}
+		expected, err = c.fileSHA256(chunkPath)
+		if err != nil {
+			return "", "", err
+		}
+		containerChunk = chunkPath
+	}
+
+	// A unique name keeps the host chunk apart from the container chunk when
+	// both dump directories are the same bind mount
+	f, err := os.CreateTemp(filepath.Dir(dstPath), filepath.Base(dstPath)+".chunk-")
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create chunk: %v", err)
+	}
+	f.Close()
+	hostChunk = f.Name()
+	if err := helpers.CopyFromContainer(client, containerName, chunkPath, hostChunk, baseDockerURL, helpers.Compression{}); err != nil {
+		os.Remove(hostChunk)
+		return "", "", err
+	}
+	if err := verifyChunk(hostChunk, length, expected); err != nil {
+		os.Remove(hostChunk)
+		return "", "", err
+	}
+	return hostChunk, containerChunk, nil
+}
+
+// verifyChunk checks the size and the SHA-256 of a chunk copied to the host.
+func verifyChunk(chunk string, length int64, expected string) error {
+	f, err := os.Open(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to open chunk: %v", err)
+	}
+	defer f.Close()
+	hash := sha256.New()
+	written, err := io.Copy(hash, f)
+	if err != nil {
+		return fmt.Errorf("failed to hash chunk: %v", err)
+	}
+	if written != length {
+		return fmt.Errorf("incomplete chunk: got %d of %d bytes", written, length)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("chunk checksum mismatch: sha256 %s in the container, %s on the host", expected, actual)
+	}
+	return nil
+}
+
+// removeContainerChunk removes a chunk cut in the container, if any.
+func (c chunkedCopy) removeContainerChunk(chunkPath string) {
+	if chunkPath == "" {
+		return
+	}
+	helpers.ExecInContainer(c.m.settings.client, c.m.target.Container, c.m.settings.baseDockerURL, "rm", "-f", chunkPath)
+}
+
+// appendChunk copies a verified chunk to w.
+func appendChunk(chunk string, w io.Writer) error {
+	f, err := os.Open(chunk)
+	if err != nil {
+		return fmt.Errorf("failed to open chunk: %v", err)
+	}
+	defer f.Close()
+	if _, err := io.Copy(w, f); err != nil {
+		return fmt.Errorf("failed to write chunk: %v", err)
+	}
+	return nil
+}
+
+// fileSize returns the size of a file in the container.
+func (c chunkedCopy) fileSize(path string) (int64, error) {
+	output, err := helpers.ExecInContainer(c.m.settings.client, c.m.target.Container, c.m.settings.baseDockerURL, "stat", "-c", "%s", path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of %s in container: %v", path, err)
+	}
+	output = strings.TrimSpace(helpers.DemuxExecOutput(output))
+	size, err := strconv.ParseInt(output, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get size of %s in container: %s", path, output)
+	}
+	return size, nil
+}
+
+// fileSHA256 returns the SHA-256 of a file in the container.
+func (c chunkedCopy) fileSHA256(path string) (string, error) {
+	output, err := helpers.ExecInContainer(c.m.settings.client, c.m.target.Container, c.m.settings.baseDockerURL, "sha256sum", path)
+	if err != nil {
+		return "", fmt.Errorf("failed to get sha256 of %s in container: %v", path, err)
+	}
+	output = helpers.DemuxExecOutput(output)
+	sum := sha256Pattern.FindString(output)
+	if sum == "" {
+		return "", fmt.Errorf("failed to get sha256 of %s in container: %s", path, strings.TrimSpace(output))
+	}
+	return sum, nil
+}
@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	helpers "github.com/NethermindEth/docker-ram-dumper/internal/_helpers"
+)
+
+func TestDemuxExecOutput(t *testing.T) {
+	framed := execFrame("line 1\n") + string([]byte{2, 0, 0, 0, 0, 0, 0, 6}) + "error\n" + execFrame("line 2\n")
+	if output := helpers.DemuxExecOutput(framed); output != "line 1\nerror\nline 2\n" {
+		t.Errorf("Unexpected demultiplexed output: %q", output)
+	}
+	if output := helpers.DemuxExecOutput("plain output\n"); output != "plain output\n" {
+		t.Errorf("Expected output that is not framed to be kept, got %q", output)
+	}
+}
+
+// fakeContainerFiles mocks the exec commands and copies of a chunked copy
+// with the files of a container kept in memory. failCopy is called before
+// every copy and can make it fail or corrupt it.
+func fakeContainerFiles(t *testing.T, files map[string][]byte, failCopy func(call int) (bool, bool)) func() {
+	originalExecInContainer := helpers.ExecInContainer
+	originalCopyFromContainer := helpers.CopyFromContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		switch command[0] {
+		case "stat":
+			return execFrame(fmt.Sprintf("%d\n", len(files[command[3]]))), nil
+		case "sha256sum":
+			sum := sha256.Sum256(files[command[1]])
+			return execFrame(hex.EncodeToString(sum[:]) + "  " + command[1] + "\n"), nil
+		case "dd":
+			args := map[string]string{}
+			for _, arg := range command[1:] {
+				name, value, _ := strings.Cut(arg, "=")
+				args[name] = value
+			}
+			bs, _ := strconv.Atoi(args["bs"])
+			skip, _ := strconv.Atoi(args["skip"])
+			count, _ := strconv.Atoi(args["count"])
+			content := files[args["if"]]
+			start, end := min(skip*bs, len(content)), min((skip+count)*bs, len(content))
+			files[args["of"]] = content[start:end]
+			return "", nil
+		case "rm":
+			delete(files, command[2])
+			return "", nil
+		}
+		t.Errorf("Unexpected command: %v", command)
+		return "", nil
+	}
+	calls := 0
+	helpers.CopyFromContainer = func(client *http.Client, containerName, srcPath, dstPath, baseDockerURL string, compression helpers.Compression) error {
+		calls++
+		fail, corrupt := failCopy(calls)
+		if fail {
+			return fmt.Errorf("failed to copy file content: unexpected EOF")
+		}
+		content := bytes.Clone(files[srcPath])
+		if corrupt {
+			content[0] ^= 0xFF
+		}
+		return os.WriteFile(dstPath, content, 0o644)
+	}
+	originalCopyRetryDelay := copyRetryDelay
+	copyRetryDelay = 0
+	return func() {
+		helpers.ExecInContainer = originalExecInContainer
+		helpers.CopyFromContainer = originalCopyFromContainer
+		copyRetryDelay = originalCopyRetryDelay
+	}
+}
+
+func TestCopyFromContainerChunked(t *testing.T) {
+	content := make([]byte, 5*copyBlockSize/2)
+	rand.Read(content)
+
+	tests := []struct {
+		name        string
+		compression helpers.Compression
+		chunkSize   int64
+		failCopy    func(call int) (bool, bool)
+		corruptSum  bool
+		expectError string
+	}{
+		{
+			name:      "Single chunk",
+			chunkSize: 4 * copyBlockSize,
+			failCopy:  func(call int) (bool, bool) { return false, false },
+		},
+		{
+			name:      "Retries a broken and a corrupted chunk",
+			chunkSize: copyBlockSize,
+			failCopy:  func(call int) (bool, bool) { return call == 2, call == 4 },
+		},
+		{
+			name:        "Compressed",
+			compression: helpers.Compression{Algorithm: helpers.CompressionGzip},
+			chunkSize:   copyBlockSize + 1,
+			failCopy:    func(call int) (bool, bool) { return call == 3, false },
+		},
+		{
+			name:        "Retries exhausted",
+			chunkSize:   copyBlockSize,
+			failCopy:    func(call int) (bool, bool) { return call > 1, false },
+			expectError: "failed to copy /tmp/dumps/core_1234_1.dmp at offset 1048576 after 4 attempts",
+		},
+		{
+			name:        "Checksum mismatch",
+			chunkSize:   copyBlockSize,
+			failCopy:    func(call int) (bool, bool) { return false, false },
+			corruptSum:  true,
+			expectError: "checksum mismatch for /tmp/dumps/core_1234_1.dmp",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "/tmp/dumps/core_1234_1.dmp"
+			files := map[string][]byte{src: content}
+			restore := fakeContainerFiles(t, files, tt.failCopy)
+			defer restore()
+			if tt.corruptSum {
+				// The file changes in the container after the checksum is taken
+				exec := helpers.ExecInContainer
+				helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+					output, err := exec(client, containerName, baseDockerURL, command...)
+					if command[0] == "sha256sum" && command[1] == src {
+						files[src] = append(bytes.Clone(content[:len(content)-1]), content[len(content)-1]^0xFF)
+					}
+					return output, err
+				}
+			}
+
+			target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1}
+			m, err := newContainerMonitor(monitorSettings{compression: tt.compression, copyChunkSize: tt.chunkSize, copyRetries: 3}, target)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			dst := filepath.Join(t.TempDir(), "core_1234_1.dmp"+tt.compression.Extension())
+
+			err = m.copyFromContainer(src, dst)
+			if tt.expectError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectError) {
+					t.Fatalf("Expected error %q, got %v", tt.expectError, err)
+				}
+				if _, err := os.Stat(dst); !os.IsNotExist(err) {
+					t.Errorf("Expected no destination file after a failed copy")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			var r io.Reader
+			f, err := os.Open(dst)
+			if err != nil {
+				t.Fatalf("Failed to open copied file: %v", err)
+			}
+			defer f.Close()
+			r = f
+			if tt.compression.Algorithm == helpers.CompressionGzip {
+				if r, err = gzip.NewReader(f); err != nil {
+					t.Fatalf("Failed to open gzip stream: %v", err)
+				}
+			}
+			copied, _ := io.ReadAll(r)
+			if !bytes.Equal(copied, content) {
+				t.Errorf("Copied content differs from the container file (%d of %d bytes)", len(copied), len(content))
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(dst)); len(entries) != 1 {
+				t.Errorf("Expected the temporary files to be removed, got %d files", len(entries))
+			}
+			if len(files) != 1 {
+				t.Errorf("Expected the chunks to be removed from the container, got %d files", len(files))
+			}
+		})
+	}
+}
+
+func TestCopyFromContainerSharedDumpDir(t *testing.T) {
+	// The container and host dump directories are the same bind mount, the
+	// container sees the files the host writes and the other way round
+	dir := t.TempDir()
+	src := filepath.Join(dir, "core_1234_1.dmp")
+	content := make([]byte, 5*copyBlockSize/2)
+	rand.Read(content)
+	if err := os.WriteFile(src, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	originalExecInContainer := helpers.ExecInContainer
+	originalCopyFromContainer := helpers.CopyFromContainer
+	helpers.ExecInContainer = func(client *http.Client, containerName, baseDockerURL string, command ...string) (string, error) {
+		switch command[0] {
+		case "stat":
+			info, err := os.Stat(command[3])
+			if err != nil {
+				return "", err
+			}
+			return execFrame(fmt.Sprintf("%d\n", info.Size())), nil
+		case "sha256sum":
+			data, err := os.ReadFile(command[1])
+			if err != nil {
+				return "", err
+			}
+			sum := sha256.Sum256(data)
+			return execFrame(hex.EncodeToString(sum[:]) + "  " + command[1] + "\n"), nil
+		case "dd":
+			args := map[string]string{}
+			for _, arg := range command[1:] {
+				name, value, _ := strings.Cut(arg, "=")
+				args[name] = value
+			}
+			bs, _ := strconv.Atoi(args["bs"])
+			skip, _ := strconv.Atoi(args["skip"])
+			count, _ := strconv.Atoi(args["count"])
+			data, err := os.ReadFile(args["if"])
+			if err != nil {
+				return "", err
+			}
+			start, end := min(skip*bs, len(data)), min((skip+count)*bs, len(data))
+			return "", os.WriteFile(args["of"], data[start:end], 0o644)
+		case "rm":
+			os.Remove(command[2])
+			return "", nil
+		}
+		t.Errorf("Unexpected command: %v", command)
+		return "", nil
+	}
+	helpers.CopyFromContainer = func(client *http.Client, containerName, srcPath, dstPath, baseDockerURL string, compression helpers.Compression) error {
+		data, err := os.ReadFile(srcPath)
+		if err != nil {
+			return err
+		}
+		return os.WriteFile(dstPath, data, 0o644)
+	}
+	defer func() {
+		helpers.ExecInContainer = originalExecInContainer
+		helpers.CopyFromContainer = originalCopyFromContainer
+	}()
+
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1}
+	m, err := newContainerMonitor(monitorSettings{copyChunkSize: copyBlockSize}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	// Without compression the dump is copied onto itself
+	if err := m.copyFromContainer(src, src); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if copied, _ := os.ReadFile(src); !bytes.Equal(copied, content) {
+		t.Errorf("Copied content differs from the container file (%d of %d bytes)", len(copied), len(content))
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("Expected only the dump to be left, got %d files", len(entries))
+	}
+}
+
+func TestCopyDumpFilesFailure(t *testing.T) {
+	content := make([]byte, copyBlockSize)
+	rand.Read(content)
+	files := map[string][]byte{"/tmp/dumps/core_1234_1.dmp_0.1234": content}
+	restore := fakeContainerFiles(t, files, func(call int) (bool, bool) { return true, false })
+	defer restore()
+
+	dir := t.TempDir()
+	target := targetConfig{Container: "test-container", Threshold: "90%", Process: "dotnet", DumpTool: "procdump", DumpsCount: 1}
+	m, err := newContainerMonitor(monitorSettings{dumpDirHost: dir, copyChunkSize: copyBlockSize, copyRetries: 1}, target)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	copied, err := m.copyDumpFiles("/tmp/dumps/core_1234_1.dmp", 1234)
+	if err == nil || !strings.Contains(err.Error(), "after 2 attempts") {
+		t.Fatalf("Expected the dump to fail once the retries are exhausted, got %v (%v)", err, copied)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected no file on the host after a failed copy, got %d", len(entries))
+	}
+}
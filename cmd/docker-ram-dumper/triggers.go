@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// memorySample is a memory usage reading taken by a monitor check.
+type memorySample struct {
+	time    time.Time
+	usageMB float64
+	percent float64
+}
+
+// memoryHistory keeps the samples of the last maxAge for the triggers that
+// look at the memory trend rather than at a single reading.
+type memoryHistory struct {
+	maxAge  time.Duration
+	samples []memorySample
+}
+
+func (h *memoryHistory) add(s memorySample) {
+	h.samples = append(h.samples, s)
+	i := 0
+	for i < len(h.samples) && s.time.Sub(h.samples[i].time) > h.maxAge {
+		i++
+	}
+	h.samples = h.samples[i:]
+}
+
+// since returns the samples taken at or after t.
+func (h *memoryHistory) since(t time.Time) []memorySample {
+	for i, s := range h.samples {
+		if !s.time.Before(t) {
+			return h.samples[i:]
+		}
+	}
+	return nil
+}
+
+// covers reports whether the history goes back at least window from now.
+func (h *memoryHistory) covers(now time.Time, window time.Duration) bool {
+	return len(h.samples) > 0 && now.Sub(h.samples[0].time) >= window
+}
+
+func (h *memoryHistory) reset() {
+	h.samples = nil
+}
+
+// trigger decides after each memory check whether a dump should be taken,
+// in addition to the memory threshold.
+type trigger interface {
+	// window is how much memory history the trigger needs.
+	window() time.Duration
+	// check returns the reason to take a dump, or an empty string.
+	check(m *containerMonitor, now memorySample) string
+}
+
+// slopeMBPerSecond returns the slope of the linear regression of the memory
+// usage over time.
+func slopeMBPerSecond(samples []memorySample) float64 {
+	if len(samples) < 2 {
+		return 0
+	}
+	start := samples[0].time
+	var sumX, sumY, sumXY, sumXX float64
+	for _, s := range samples {
+		x := s.time.Sub(start).Seconds()
+		sumX += x
+		sumY += s.usageMB
+		sumXY += x * s.usageMB
+		sumXX += x * x
+	}
+	n := float64(len(samples))
+	denominator := n*sumXX - sumX*sumX
+	if denominator == 0 {
+		return 0
+	}
+	return (n*sumXY - sumX*sumY) / denominator
+}
+
+// growthTrigger fires when the memory grows by at least deltaMB over period,
+// based on the regression slope of the samples of that period so that short
+// spikes do not count as a leak.
+type growthTrigger struct {
+	deltaMB float64
+	period  time.Duration
+}
+
+// minGrowthSamples is the number of samples needed for a meaningful slope.
+const minGrowthSamples = 3
+
+// parseGrowthTrigger parses a growth rule such as "200MB/15m" or "1GB/1h".
+func parseGrowthTrigger(rule string) (*growthTrigger, error) {
+	size, period, ok := strings.Cut(rule, "/")
+	if !ok {
+		return nil, fmt.Errorf("invalid growth rule %q, expected <size>/<duration> (e.g. 200MB/15m)", rule)
+	}
+	deltaMB, err := parseSizeMB(size)
+	if err != nil {
+		return nil, fmt.Errorf("invalid growth rule %q: %v", rule, err)
+	}
+	duration, err := time.ParseDuration(strings.TrimSpace(period))
+	if err != nil {
+		return nil, fmt.Errorf("invalid growth rule %q: %v", rule, err)
+	}
+	if deltaMB <= 0 || duration <= 0 {
+		return nil, fmt.Errorf("invalid growth rule %q: size and duration must be positive", rule)
+	}
+	return &growthTrigger{deltaMB: deltaMB, period: duration}, nil
+}
+
+func (g *growthTrigger) window() time.Duration {
+	return g.period
+}
+
+func (g *growthTrigger) check(m *containerMonitor, now memorySample) string {
+	if !m.history.covers(now.time, g.period) {
+		return ""
+	}
+	samples := m.history.since(now.time.Add(-g.period))
+	if len(samples) < minGrowthSamples {
+		return ""
+	}
+	growthMB := slopeMBPerSecond(samples) * g.period.Seconds()
+	m.logf("Memory growth trend: %+.0f MB per %v (trigger at +%.0f MB)", growthMB, g.period, g.deltaMB)
+	if growthMB < g.deltaMB {
+		return ""
+	}
+	return fmt.Sprintf("memory grew by %+.0f MB per %v, above the growth limit of %.0f MB", growthMB, g.period, g.deltaMB)
+}
+
+// parseSizeMB parses a size with an MB or GB unit into megabytes. Values
+// without a unit are megabytes.
+func parseSizeMB(size string) (float64, error) {
+	size = strings.ToLower(strings.TrimSpace(size))
+	multiplier := 1.0
+	switch {
+	case strings.HasSuffix(size, "gb"):
+		multiplier = 1024
+		size = strings.TrimSuffix(size, "gb")
+	case strings.HasSuffix(size, "mb"):
+		size = strings.TrimSuffix(size, "mb")
+	}
+	value, err := strconv.ParseFloat(strings.TrimSpace(size), 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %v", size, err)
+	}
+	return value * multiplier, nil
+}
+
+// forecastTrigger estimates the time until the memory limit is reached from
+// the regression slope of the recent samples, and fires when it drops below
+// the horizon.
+type forecastTrigger struct {
+	horizon time.Duration
+	period  time.Duration
+}
+
+func (f *forecastTrigger) window() time.Duration {
+	return f.period
+}
+
+func (f *forecastTrigger) check(m *containerMonitor, now memorySample) string {
+	timeToOOM, ok, _ := f.forecast(m, now)
+	if !ok || timeToOOM > f.horizon {
+		return ""
+	}
+	return fmt.Sprintf("memory limit forecast to be reached in %v, within the horizon of %v", timeToOOM.Round(time.Second), f.horizon)
+}
+
+// forecast returns the time to OOM forecast from the samples of the window,
+// and a status line for the log. It reports false while samples are being
+// collected or when memory is not growing.
+func (f *forecastTrigger) forecast(m *containerMonitor, now memorySample) (time.Duration, bool, string) {
+	samples := m.history.since(now.time.Add(-f.period))
+	if len(samples) < minGrowthSamples {
+		return 0, false, fmt.Sprintf("collecting samples (%d of %d)", len(samples), minGrowthSamples)
+	}
+	timeToOOM, ok := forecastTimeToOOM(samples, float64(m.memoryLimitMB))
+	if !ok {
+		return 0, false, "memory is not growing"
+	}
+	return timeToOOM, true, fmt.Sprintf("%v at the current rate of %+.1f MB/min (dump below %v)", timeToOOM.Round(time.Second), slopeMBPerSecond(samples)*60, f.horizon)
+}
+
+// logForecast logs the time to OOM forecast of the last memory reading. It is
+// called on every check, also when the forecast trigger is not evaluated
+// because of the cooldown or a running dump series.
+func (m *containerMonitor) logForecast() {
+	if len(m.history.samples) == 0 {
+		return
+	}
+	now := m.history.samples[len(m.history.samples)-1]
+	for _, t := range m.triggers {
+		if f, ok := t.(*forecastTrigger); ok {
+			_, _, status := f.forecast(m, now)
+			m.logf("Time to OOM: %s", status)
+		}
+	}
+}
+
+// forecastTimeToOOM extrapolates the memory trend of the samples to the limit.
+// It reports false when memory is not growing.
+func forecastTimeToOOM(samples []memorySample, limitMB float64) (time.Duration, bool) {
+	slope := slopeMBPerSecond(samples)
+	if slope <= 0 || limitMB <= 0 {
+		return 0, false
+	}
+	remainingMB := limitMB - samples[len(samples)-1].usageMB
+	if remainingMB <= 0 {
+		return 0, true
+	}
+	return time.Duration(remainingMB / slope * float64(time.Second)), true
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGrowthTrigger(t *testing.T) {
+	growth, err := parseGrowthTrigger("200MB/15m")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if growth.deltaMB != 200 || growth.period != 15*time.Minute {
+		t.Errorf("Unexpected growth trigger: %+v", growth)
+	}
+
+	growth, err = parseGrowthTrigger("1.5GB/1h")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if growth.deltaMB != 1536 || growth.period != time.Hour {
+		t.Errorf("Unexpected growth trigger: %+v", growth)
+	}
+
+	for _, rule := range []string{"200MB", "abc/15m", "200MB/soon", "-5MB/1m"} {
+		if _, err := parseGrowthTrigger(rule); err == nil {
+			t.Errorf("Expected an error for %q", rule)
+		}
+	}
+}
+
+func TestSlopeMBPerSecond(t *testing.T) {
+	start := time.Unix(0, 0)
+	samples := []memorySample{
+		{time: start, usageMB: 1000},
+		{time: start.Add(10 * time.Second), usageMB: 1020},
+		{time: start.Add(20 * time.Second), usageMB: 1040},
+		{time: start.Add(30 * time.Second), usageMB: 1060},
+	}
+	if slope := slopeMBPerSecond(samples); math.Abs(slope-2) > 1e-9 {
+		t.Errorf("Expected a slope of 2 MB/s, got %f", slope)
+	}
+}
+
+func TestGrowthTrigger(t *testing.T) {
+	m := &containerMonitor{target: targetConfig{Container: "test-container"}}
+	m.history.maxAge = 20 * time.Minute
+	growth := &growthTrigger{deltaMB: 200, period: 10 * time.Minute}
+
+	start := time.Unix(0, 0)
+	var now memorySample
+	// 15 MB per minute, 150 MB per 10 minutes
+	for i := 0; i <= 10; i++ {
+		now = memorySample{time: start.Add(time.Duration(i) * time.Minute), usageMB: 1000 + float64(i)*15}
+		m.history.add(now)
+	}
+	if reason := growth.check(m, now); reason != "" {
+		t.Errorf("Expected no trigger, got %q", reason)
+	}
+
+	// 30 MB per minute afterwards, 300 MB per 10 minutes
+	for i := 11; i <= 20; i++ {
+		now = memorySample{time: start.Add(time.Duration(i) * time.Minute), usageMB: 1150 + float64(i-10)*30}
+		m.history.add(now)
+	}
+	if reason := growth.check(m, now); reason == "" {
+		t.Error("Expected the growth trigger to fire")
+	}
+}
+
+func TestForecastTimeToOOM(t *testing.T) {
+	start := time.Unix(0, 0)
+	samples := []memorySample{
+		{time: start, usageMB: 3000},
+		{time: start.Add(time.Minute), usageMB: 3060},
+		{time: start.Add(2 * time.Minute), usageMB: 3120},
+	}
+	// 60 MB per minute, 880 MB left
+	timeToOOM, ok := forecastTimeToOOM(samples, 4000)
+	if !ok {
+		t.Fatal("Expected a forecast")
+	}
+	if expected := 880 * time.Second; timeToOOM < expected-time.Second || timeToOOM > expected+time.Second {
+		t.Errorf("Unexpected time to OOM: got %v, want %v", timeToOOM, expected)
+	}
+
+	flat := []memorySample{{time: start, usageMB: 3000}, {time: start.Add(time.Minute), usageMB: 2990}}
+	if _, ok := forecastTimeToOOM(flat, 4000); ok {
+		t.Error("Expected no forecast when memory is not growing")
+	}
+}
+
+func TestForecastTrigger(t *testing.T) {
+	m := &containerMonitor{target: targetConfig{Container: "test-container"}, memoryLimitMB: 4000}
+	m.history.maxAge = time.Hour
+	forecast := &forecastTrigger{horizon: 10 * time.Minute, period: 5 * time.Minute}
+
+	start := time.Unix(0, 0)
+	now := memorySample{time: start, usageMB: 2750}
+	m.history.add(now)
+	if _, ok, status := forecast.forecast(m, now); ok || status != fmt.Sprintf("collecting samples (1 of %d)", minGrowthSamples) {
+		t.Errorf("Expected samples to be collected, got %q", status)
+	}
+	// 50 MB per minute, 20 minutes left
+	for i := 1; i <= 5; i++ {
+		now = memorySample{time: start.Add(time.Duration(i) * time.Minute), usageMB: 2750 + float64(i)*50}
+		m.history.add(now)
+	}
+	if reason := forecast.check(m, now); reason != "" {
+		t.Errorf("Expected no trigger, got %q", reason)
+	}
+	if timeToOOM, ok, status := forecast.forecast(m, now); !ok || timeToOOM != 20*time.Minute || !strings.HasPrefix(status, "20m0s at the current rate of +50.0 MB/min") {
+		t.Errorf("Unexpected forecast: %v (%v) %q", timeToOOM, ok, status)
+	}
+
+	// 100 MB per minute, about 5 minutes left
+	for i := 6; i <= 10; i++ {
+		now = memorySample{time: start.Add(time.Duration(i) * time.Minute), usageMB: 3000 + float64(i-5)*100}
+		m.history.add(now)
+	}
+	if reason := forecast.check(m, now); reason == "" {
+		t.Error("Expected the forecast trigger to fire")
+	}
+}
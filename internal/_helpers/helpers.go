@@ -1,20 +1,26 @@
 package helpers
 
 import (
+	"archive/tar"
 	"bytes"
+	"compress/gzip"
 	"context"
+	"encoding/binary"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/client"
+	"github.com/klauspost/compress/zstd"
 )
 
 const (
@@ -185,14 +191,77 @@ func RunDockerRamDumper(flags map[string]string) ([]byte, error) {
 	return cmd.CombinedOutput()
 }
 
+// Memory metrics that can be compared against the threshold.
+const (
+	// MemoryMetricUsage is the raw cgroup usage, including the page cache.
+	MemoryMetricUsage = "usage"
+	// MemoryMetricWorkingSet is the usage without inactive file pages, as shown by docker stats.
+	MemoryMetricWorkingSet = "working-set"
+	// MemoryMetricAnon is the anonymous memory (heap, stacks) of the container.
+	MemoryMetricAnon = "anon"
+	// MemoryMetricRSS is the resident set size as accounted by the cgroup.
+	MemoryMetricRSS = "rss"
+)
+
+// MemoryMetrics lists the supported memory metrics.
+var MemoryMetrics = []string{MemoryMetricUsage, MemoryMetricWorkingSet, MemoryMetricAnon, MemoryMetricRSS}
+
+// MemoryMetric is the metric GetContainerMemoryUsage compares against the limit.
+var MemoryMetric = MemoryMetricWorkingSet
+
 // DockerStats struct to parse Docker stats JSON response
 type DockerStats struct {
 	MemoryStats struct {
 		Usage uint64 `json:"usage"`
 		Limit uint64 `json:"limit"`
+		// Stats holds the cgroup memory.stat counters. Their names differ
+		// between cgroup v1 (total_inactive_file, total_rss, ...) and cgroup v2
+		// (inactive_file, anon, file, ...).
+		Stats map[string]uint64 `json:"stats"`
 	} `json:"memory_stats"`
 }
 
+// stat returns the first of the given memory.stat counters present in the stats.
+func (s DockerStats) stat(names ...string) (uint64, bool) {
+	for _, name := range names {
+		if value, ok := s.MemoryStats.Stats[name]; ok {
+			return value, true
+		}
+	}
+	return 0, false
+}
+
+// WorkingSet returns the usage without inactive file pages, the same way the
+// docker CLI computes the memory usage shown by docker stats.
+func (s DockerStats) WorkingSet() uint64 {
+	inactiveFile, _ := s.stat("total_inactive_file", "inactive_file")
+	if inactiveFile > s.MemoryStats.Usage {
+		return s.MemoryStats.Usage
+	}
+	return s.MemoryStats.Usage - inactiveFile
+}
+
+// MemoryValue returns the memory in bytes accounted by the given metric.
+func (s DockerStats) MemoryValue(metric string) (uint64, error) {
+	switch metric {
+	case MemoryMetricUsage:
+		return s.MemoryStats.Usage, nil
+	case MemoryMetricWorkingSet:
+		return s.WorkingSet(), nil
+	case MemoryMetricAnon:
+		if anon, ok := s.stat("anon", "total_rss", "rss"); ok {
+			return anon, nil
+		}
+	case MemoryMetricRSS:
+		if rss, ok := s.stat("total_rss", "rss", "anon"); ok {
+			return rss, nil
+		}
+	default:
+		return 0, fmt.Errorf("unsupported memory metric: %s (supported: %s)", metric, strings.Join(MemoryMetrics, ", "))
+	}
+	return 0, fmt.Errorf("memory metric %s is not reported by the Docker daemon", metric)
+}
+
 var GetContainerMemoryUsage = func(client *http.Client, containerID, baseDockerURL string, printStats bool) (float64, uint64, error) {
 	// Docker API endpoint for container stats
 	url := fmt.Sprintf("%s/containers/%s/stats?stream=false", baseDockerURL, containerID)
@@ -217,12 +286,17 @@ var GetContainerMemoryUsage = func(client *http.Client, containerID, baseDockerU
 		return 0, 0, err
 	}
 
+	value, err := stats.MemoryValue(MemoryMetric)
+	if err != nil {
+		return 0, 0, err
+	}
+
 	// Calculate memory usage percentage
-	memUsage := float64(stats.MemoryStats.Usage) / float64(stats.MemoryStats.Limit) * 100
+	memUsage := float64(value) / float64(stats.MemoryStats.Limit) * 100
 	if printStats {
 		fmt.Printf("Docker RAM limit: %d MB\n", stats.MemoryStats.Limit/1024/1024)
 	}
-	fmt.Printf("Container memory usage: %d MB\n", stats.MemoryStats.Usage/1024/1024)
+	fmt.Printf("Container memory usage: %d MB (%s: %d MB)\n", stats.MemoryStats.Usage/1024/1024, MemoryMetric, value/1024/1024)
 	return memUsage, stats.MemoryStats.Limit / 1024 / 1024, nil
 }
 
@@ -280,6 +354,211 @@ var ExecInContainer = func(client *http.Client, containerName, baseDockerURL str
 	return output.String(), nil
 }
 
+// DemuxExecOutput returns the content of the output of ExecInContainer. Without
+// a TTY, Docker multiplexes stdout and stderr in frames made of a header, the
+// stream type, three zero bytes and the big endian frame size, followed by the
+// frame content. Output that is not framed is returned as is.
+func DemuxExecOutput(output string) string {
+	var content strings.Builder
+	data := output
+	for len(data) > 0 {
+		if len(data) < 8 || data[0] > 2 || data[1] != 0 || data[2] != 0 || data[3] != 0 {
+			return output
+		}
+		size := int(binary.BigEndian.Uint32([]byte(data[4:8])))
+		if len(data)-8 < size {
+			return output
+		}
+		content.WriteString(data[8 : 8+size])
+		data = data[8+size:]
+	}
+	return content.String()
+}
+
+// ContainerSummary is an entry of the Docker container list endpoint.
+type ContainerSummary struct {
+	ID     string            `json:"Id"`
+	Names  []string          `json:"Names"`
+	State  string            `json:"State"`
+	Labels map[string]string `json:"Labels"`
+}
+
+// Name returns the container name without the leading slash.
+func (c ContainerSummary) Name() string {
+	if len(c.Names) == 0 {
+		return c.ID
+	}
+	return strings.TrimPrefix(c.Names[0], "/")
+}
+
+// ListContainers returns the running containers matching all the label filters
+// (e.g. "ram-dumper.enabled=true").
+var ListContainers = func(client *http.Client, baseDockerURL string, labels []string) ([]ContainerSummary, error) {
+	filters, err := json.Marshal(map[string][]string{"label": labels})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal filters: %v", err)
+	}
+	resp, err := client.Get(fmt.Sprintf("%s/containers/json?filters=%s", baseDockerURL, url.QueryEscape(string(filters))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list containers: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to list containers: HTTP status %d", resp.StatusCode)
+	}
+
+	var containers []ContainerSummary
+	if err := json.NewDecoder(resp.Body).Decode(&containers); err != nil {
+		return nil, fmt.Errorf("failed to decode container list: %v", err)
+	}
+	return containers, nil
+}
+
+// DockerEvent is a message of the Docker events stream.
+type DockerEvent struct {
+	Type   string `json:"Type"`
+	Action string `json:"Action"`
+	Actor  struct {
+		ID         string            `json:"ID"`
+		Attributes map[string]string `json:"Attributes"`
+	} `json:"Actor"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// Time returns the time the event happened.
+func (e DockerEvent) Time() time.Time {
+	return time.Unix(0, e.TimeNano)
+}
+
+// WatchContainerEvents subscribes to the Docker events stream and calls handle
+// for every container event with one of the given actions. It blocks until
+// ctx is done or the stream breaks.
+var WatchContainerEvents = func(ctx context.Context, client *http.Client, baseDockerURL string, actions []string, handle func(DockerEvent)) error {
+	filters, err := json.Marshal(map[string][]string{"type": {"container"}, "event": actions})
+	if err != nil {
+		return fmt.Errorf("failed to marshal filters: %v", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/events?filters=%s", baseDockerURL, url.QueryEscape(string(filters))), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create events request: %v", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to subscribe to events: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to subscribe to events: HTTP status %d", resp.StatusCode)
+	}
+
+	decoder := json.NewDecoder(resp.Body)
+	for {
+		var event DockerEvent
+		if err := decoder.Decode(&event); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("failed to read events stream: %v", err)
+		}
+		handle(event)
+	}
+}
+
+// ContainerInspect holds the fields of the container inspect endpoint used by
+// the dumper.
+type ContainerInspect struct {
+	ID    string `json:"Id"`
+	Name  string `json:"Name"`
+	Image string `json:"Image"`
+	State struct {
+		Running bool `json:"Running"`
+		Pid     int  `json:"Pid"`
+	} `json:"State"`
+	Config struct {
+		Image string `json:"Image"`
+	} `json:"Config"`
+}
+
+// InspectContainer returns the details of a container.
+var InspectContainer = func(client *http.Client, containerName, baseDockerURL string) (ContainerInspect, error) {
+	var inspect ContainerInspect
+	resp, err := client.Get(fmt.Sprintf("%s/containers/%s/json", baseDockerURL, containerName))
+	if err != nil {
+		return inspect, fmt.Errorf("failed to inspect container: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return inspect, fmt.Errorf("failed to inspect container %s: HTTP status %d", containerName, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return inspect, fmt.Errorf("failed to decode inspect response: %v", err)
+	}
+	return inspect, nil
+}
+
+// ImageInspect holds the fields of the image inspect endpoint used by the dumper.
+type ImageInspect struct {
+	ID          string   `json:"Id"`
+	RepoDigests []string `json:"RepoDigests"`
+}
+
+// InspectImage returns the details of an image.
+var InspectImage = func(client *http.Client, image, baseDockerURL string) (ImageInspect, error) {
+	var inspect ImageInspect
+	resp, err := client.Get(fmt.Sprintf("%s/images/%s/json", baseDockerURL, image))
+	if err != nil {
+		return inspect, fmt.Errorf("failed to inspect image: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return inspect, fmt.Errorf("failed to inspect image %s: HTTP status %d", image, resp.StatusCode)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(&inspect); err != nil {
+		return inspect, fmt.Errorf("failed to decode image inspect response: %v", err)
+	}
+	return inspect, nil
+}
+
+// GetDockerHostName returns the name of the host the Docker daemon runs on.
+var GetDockerHostName = func(client *http.Client, baseDockerURL string) (string, error) {
+	resp, err := client.Get(baseDockerURL + "/info")
+	if err != nil {
+		return "", fmt.Errorf("failed to get Docker info: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get Docker info: HTTP status %d", resp.StatusCode)
+	}
+
+	var info struct {
+		Name string `json:"Name"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+		return "", fmt.Errorf("failed to decode Docker info: %v", err)
+	}
+	return info.Name, nil
+}
+
+// GetContainerHostPID returns the host PID of the container init process,
+// as reported by State.Pid of the container inspect endpoint.
+var GetContainerHostPID = func(client *http.Client, containerName, baseDockerURL string) (int, error) {
+	inspect, err := InspectContainer(client, containerName, baseDockerURL)
+	if err != nil {
+		return 0, err
+	}
+	if !inspect.State.Running || inspect.State.Pid == 0 {
+		return 0, fmt.Errorf("container %s is not running", containerName)
+	}
+	return inspect.State.Pid, nil
+}
+
 func GetPIDInContainer(client *http.Client, containerName, processName, baseDockerURL string) (int, error) {
 	command := []string{"sh", "-c", fmt.Sprintf("ps -ef | grep '%s' | grep -v grep | tail -n1", processName)}
 	output, err := ExecInContainer(client, containerName, baseDockerURL, command...)
@@ -308,12 +587,84 @@ func GetPIDInContainer(client *http.Client, containerName, processName, baseDock
 	return pid, nil
 }
 
-func CopyFromContainer(client *http.Client, containerName, srcPath, dstPath, baseDockerURL string) error {
+// Compression algorithms of the files copied by CopyFromContainer.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+	CompressionZstd = "zstd"
+)
+
+var Compressions = []string{CompressionNone, CompressionGzip, CompressionZstd}
+
+// Compression selects how CopyFromContainer compresses the file it writes.
+// A zero Level uses the default level of the algorithm.
+type Compression struct {
+	Algorithm string
+	Level     int
+}
+
+// Extension returns the file extension added by the compression algorithm.
+func (c Compression) Extension() string {
+	switch c.Algorithm {
+	case CompressionGzip:
+		return ".gz"
+	case CompressionZstd:
+		return ".zst"
+	}
+	return ""
+}
+
+// Validate checks the algorithm and the level, gzip levels go from 1 to 9 and
+// zstd levels from 1 to 22.
+func (c Compression) Validate() error {
+	maxLevel := 0
+	switch c.Algorithm {
+	case "", CompressionNone:
+		return nil
+	case CompressionGzip:
+		maxLevel = gzip.BestCompression
+	case CompressionZstd:
+		maxLevel = 22
+	default:
+		return fmt.Errorf("unsupported compression: %s (supported: %s)", c.Algorithm, strings.Join(Compressions, ", "))
+	}
+	if c.Level < 0 || c.Level > maxLevel {
+		return fmt.Errorf("invalid %s compression level %d, expected 1 to %d", c.Algorithm, c.Level, maxLevel)
+	}
+	return nil
+}
+
+// NewWriter returns a writer compressing into w, or nil without compression.
+func (c Compression) NewWriter(w io.Writer) (io.WriteCloser, error) {
+	switch c.Algorithm {
+	case CompressionGzip:
+		level := gzip.DefaultCompression
+		if c.Level > 0 {
+			level = c.Level
+		}
+		return gzip.NewWriterLevel(w, level)
+	case CompressionZstd:
+		level := zstd.SpeedDefault
+		if c.Level > 0 {
+			level = zstd.EncoderLevelFromZstd(c.Level)
+		}
+		return zstd.NewWriter(w, zstd.WithEncoderLevel(level))
+	}
+	return nil, nil
+}
+
+// CopyFromContainer streams srcPath out of the container through the Docker
+// archive API and extracts the file from the tar stream into dstPath on the host,
+// compressing it on the fly with compression. dstPath should carry the
+// compression extension.
+// The data is written to a temporary file next to dstPath and renamed once the
+// transfer is complete, so a broken copy never leaves a truncated dump behind.
+var CopyFromContainer = func(client *http.Client, containerName, srcPath, dstPath, baseDockerURL string, compression Compression) error {
 	// Docker API endpoint for copying files from a container
-	url := fmt.Sprintf("%s/containers/%s/archive?path=%s", baseDockerURL, containerName, srcPath)
+	archiveURL := fmt.Sprintf("%s/containers/%s/archive?path=%s", baseDockerURL, containerName, url.QueryEscape(srcPath))
 
 	// Send GET request to Docker API
-	resp, err := client.Get(url)
+	resp, err := client.Get(archiveURL)
 	if err != nil {
 		return fmt.Errorf("failed to send request to Docker API: %v", err)
 	}
@@ -323,20 +674,77 @@ func CopyFromContainer(client *http.Client, containerName, srcPath, dstPath, bas
 		return fmt.Errorf("failed to copy file from container: %s. (HTTP status %d)", srcPath, resp.StatusCode)
 	}
 
-	// Create the destination file
-	dstFile, err := os.Create(dstPath)
+	// The archive endpoint always returns a tar stream, find the dump file in it
+	tr := tar.NewReader(resp.Body)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no regular file found in archive for: %s", srcPath)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read archive: %v", err)
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		written, err := writeFileAtomically(dstPath, tr, compression)
+		if err != nil {
+			return err
+		}
+		if written != header.Size {
+			os.Remove(dstPath)
+			return fmt.Errorf("incomplete copy of %s: got %d of %d bytes", srcPath, written, header.Size)
+		}
+		if info, err := os.Stat(dstPath); err == nil && info.Size() != written {
+			fmt.Printf("Copied file from container: %s to host: %s (%d MB, %d MB compressed)\n", srcPath, dstPath, written/1024/1024, info.Size()/1024/1024)
+			return nil
+		}
+		fmt.Printf("Copied file from container: %s to host: %s (%d MB)\n", srcPath, dstPath, written/1024/1024)
+		return nil
+	}
+}
+
+// writeFileAtomically copies r into a temporary file, compressed with
+// compression, and renames it to dstPath. It returns the number of bytes read
+// from r.
+func writeFileAtomically(dstPath string, r io.Reader, compression Compression) (int64, error) {
+	tmpPath := dstPath + ".part"
+	dstFile, err := os.Create(tmpPath)
 	if err != nil {
-		return fmt.Errorf("failed to create destination file: %v", err)
+		return 0, fmt.Errorf("failed to create destination file: %v", err)
 	}
-	defer dstFile.Close()
 
-	// Copy the content from the response body to the destination file
-	_, err = io.Copy(dstFile, resp.Body)
+	var w io.Writer = dstFile
+	compressor, err := compression.NewWriter(dstFile)
 	if err != nil {
-		return fmt.Errorf("failed to copy file content: %v", err)
+		dstFile.Close()
+		os.Remove(tmpPath)
+		return 0, fmt.Errorf("failed to create compressor: %v", err)
 	}
-	fmt.Printf("Copied file from container: %s to host: %s\n", srcPath, dstPath)
-	return nil
+	if compressor != nil {
+		w = compressor
+	}
+
+	written, err := io.Copy(w, r)
+	if compressor != nil {
+		if closeErr := compressor.Close(); err == nil {
+			err = closeErr
+		}
+	}
+	if closeErr := dstFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return written, fmt.Errorf("failed to copy file content: %v", err)
+	}
+
+	if err := os.Rename(tmpPath, dstPath); err != nil {
+		os.Remove(tmpPath)
+		return written, fmt.Errorf("failed to move file into place: %v", err)
+	}
+	return written, nil
 }
 
 func RunCommand(name string, args ...string) ([]byte, error) {
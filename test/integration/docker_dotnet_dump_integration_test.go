@@ -204,10 +204,7 @@ func TestDotnetDumpThreasholdMBScenario(t *testing.T) {
 }
 
 func checkDotnetDumpFiles(t *testing.T, filesCount int) {
-	dumpFiles, err := os.ReadDir(helpers.TestDumpsDir)
-	if err != nil {
-		t.Fatalf("Failed to read dump directory: %v", err)
-	}
+	dumpFiles := readDumpFiles(t)
 
 	if len(dumpFiles) != filesCount {
 		t.Errorf("Expected %d dump files, but found %d", filesCount, len(dumpFiles))
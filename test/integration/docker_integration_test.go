@@ -184,11 +184,25 @@ func TestThreasholdMBScenario(t *testing.T) {
 	checkDumpFiles(t, 1)
 }
 
-func checkDumpFiles(t *testing.T, filesCount int) {
-	dumpFiles, err := os.ReadDir(helpers.TestDumpsDir)
+// readDumpFiles lists the dumps in the test dump directory, without the
+// manifests written next to them and the dump history.
+func readDumpFiles(t *testing.T) []os.DirEntry {
+	entries, err := os.ReadDir(helpers.TestDumpsDir)
 	if err != nil {
 		t.Fatalf("Failed to read dump directory: %v", err)
 	}
+	var dumpFiles []os.DirEntry
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".json") || entry.Name() == "dump-history.jsonl" {
+			continue
+		}
+		dumpFiles = append(dumpFiles, entry)
+	}
+	return dumpFiles
+}
+
+func checkDumpFiles(t *testing.T, filesCount int) {
+	dumpFiles := readDumpFiles(t)
 
 	if len(dumpFiles) != filesCount {
 		// if there are more than one file, check if all files have the same name